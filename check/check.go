@@ -12,5 +12,9 @@ func CheckEnvVariable() {
 		logger.FatalLog("环境变量 USER_ID 未设置")
 	}
 
+	if config.BackendSecret == "" && (config.MetricsEnable == 1 || config.BackendApiEnable == 1) {
+		logger.SysLog("环境变量 BACKEND_SECRET 未设置,监控指标与管理接口不开放")
+	}
+
 	logger.SysLog("environment variable check passed.")
 }
@@ -0,0 +1,442 @@
+package config
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"getbind2api/common/random"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// usageDateLayout 按天统计用量时使用的日期格式
+const usageDateLayout = "2006-01-02"
+
+var (
+	ErrApiKeyNotFound = errors.New("api key not found")
+	ErrApiKeyExists   = errors.New("api key already exists")
+)
+
+// ApiKeyInfo 通过管理接口创建的API-KEY,可限制模型、请求频率与每日token数。
+// 只保存密钥的哈希与脱敏后的前后缀,完整密钥仅在创建时返回一次
+type ApiKeyInfo struct {
+	Id          string     `json:"id" gorm:"column:api_key;primaryKey;size:255"` // 由密钥哈希生成,见 ApiKeyId
+	KeyHash     string     `json:"-" gorm:"size:64"`
+	MaskedKey   string     `json:"masked_key" gorm:"size:32"`
+	Name        string     `json:"name,omitempty" gorm:"size:255"`
+	Models      []string   `json:"models,omitempty" gorm:"serializer:json;type:text"` // 可使用的模型(对外的模型名),为空时可使用全部模型
+	RateLimit   int        `json:"rate_limit,omitempty"`                              // 每分钟请求数上限,为0时不限制
+	DailyTokens int        `json:"daily_tokens,omitempty"`                            // 每日token数(提示词+补全)上限,为0时不限制
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Disabled    bool       `json:"disabled"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+func (ApiKeyInfo) TableName() string {
+	return "api_keys"
+}
+
+// Expired 判断API-KEY是否已过期
+func (info ApiKeyInfo) Expired() bool {
+	return info.ExpiresAt != nil && !info.ExpiresAt.After(time.Now())
+}
+
+// ApiKeyUsage API-KEY的用量,当日用量在日期变化后清零
+type ApiKeyUsage struct {
+	KeyId                 string `json:"key_id"`
+	Date                  string `json:"date"`
+	Requests              int    `json:"requests"`
+	PromptTokens          int    `json:"prompt_tokens"`
+	CompletionTokens      int    `json:"completion_tokens"`
+	TotalRequests         int64  `json:"total_requests"`
+	TotalPromptTokens     int64  `json:"total_prompt_tokens"`
+	TotalCompletionTokens int64  `json:"total_completion_tokens"`
+}
+
+// Tokens 当日已使用的token数
+func (usage ApiKeyUsage) Tokens() int {
+	return usage.PromptTokens + usage.CompletionTokens
+}
+
+// apiKeyUsageRecord api_key_usages 表,按天汇总各API-KEY的用量
+type apiKeyUsageRecord struct {
+	KeyId            string `gorm:"column:api_key;primaryKey;size:255"`
+	Date             string `gorm:"primaryKey;size:10"`
+	Requests         int64
+	PromptTokens     int64
+	CompletionTokens int64
+}
+
+func (apiKeyUsageRecord) TableName() string {
+	return "api_key_usages"
+}
+
+var (
+	apiKeys       []*ApiKeyInfo               // 按创建顺序保存,受 apiKeysMutex 保护
+	apiKeyUsage   = map[string]*ApiKeyUsage{} // 包括环境变量 API_SECRET 中的API-KEY
+	apiKeyWindows = map[string][]time.Time{}  // 最近一分钟内的请求时间,不持久化
+	apiKeysMutex  sync.Mutex
+
+	// pendingUsage 尚未写入数据库的用量,由 FlushApiKeyUsage 定期批量写入
+	pendingUsage      = map[apiKeyUsageId]*apiKeyUsageRecord{}
+	pendingUsageMutex sync.Mutex
+)
+
+type apiKeyUsageId struct {
+	KeyId string
+	Date  string
+}
+
+// HashApiKey 返回密钥的 SHA-256 哈希
+func HashApiKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// ApiKeyId 返回密钥的ID(key_ 加哈希前16位),用于统计用量、请求日志与管理接口,空密钥返回空字符串
+func ApiKeyId(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "key_" + HashApiKey(secret)[:16]
+}
+
+// MaskApiKey 只保留密钥的前后几位,用于在管理接口中辨认密钥
+func MaskApiKey(secret string) string {
+	if len(secret) <= 12 {
+		return secret[:min(len(secret), 3)] + "..."
+	}
+	return secret[:6] + "..." + secret[len(secret)-4:]
+}
+
+// InitApiKeys 从数据库加载API-KEY,以及各API-KEY当日与累计的用量
+func InitApiKeys() error {
+	apiKeysMutex.Lock()
+	defer apiKeysMutex.Unlock()
+
+	var keys []*ApiKeyInfo
+	if err := DB.Order("created_at").Find(&keys).Error; err != nil {
+		return err
+	}
+
+	var totals []apiKeyUsageRecord
+	err := DB.Model(&apiKeyUsageRecord{}).
+		Select("api_key, SUM(requests) AS requests, SUM(prompt_tokens) AS prompt_tokens, SUM(completion_tokens) AS completion_tokens").
+		Group("api_key").
+		Find(&totals).Error
+	if err != nil {
+		return err
+	}
+	var today []apiKeyUsageRecord
+	if err = DB.Where("date = ?", time.Now().Format(usageDateLayout)).Find(&today).Error; err != nil {
+		return err
+	}
+
+	apiKeys = keys
+	apiKeyUsage = map[string]*ApiKeyUsage{}
+	for _, total := range totals {
+		apiKeyUsage[total.KeyId] = &ApiKeyUsage{
+			KeyId:                 total.KeyId,
+			TotalRequests:         total.Requests,
+			TotalPromptTokens:     total.PromptTokens,
+			TotalCompletionTokens: total.CompletionTokens,
+		}
+	}
+	for _, record := range today {
+		usage := apiKeyUsage[record.KeyId]
+		usage.Date = record.Date
+		usage.Requests = int(record.Requests)
+		usage.PromptTokens = int(record.PromptTokens)
+		usage.CompletionTokens = int(record.CompletionTokens)
+	}
+	return nil
+}
+
+func findApiKeyLocked(id string) *ApiKeyInfo {
+	for _, info := range apiKeys {
+		if info.Id == id {
+			return info
+		}
+	}
+	return nil
+}
+
+// HasApiKeys 是否通过管理接口创建过API-KEY
+func HasApiKeys() bool {
+	apiKeysMutex.Lock()
+	defer apiKeysMutex.Unlock()
+	return len(apiKeys) > 0
+}
+
+// GetApiKey 按ID查询通过管理接口创建的API-KEY
+func GetApiKey(id string) (ApiKeyInfo, bool) {
+	apiKeysMutex.Lock()
+	defer apiKeysMutex.Unlock()
+
+	info := findApiKeyLocked(id)
+	if info == nil {
+		return ApiKeyInfo{}, false
+	}
+	return *info, true
+}
+
+// LookupApiKey 按请求中的密钥查询通过管理接口创建的API-KEY
+func LookupApiKey(secret string) (ApiKeyInfo, bool) {
+	info, ok := GetApiKey(ApiKeyId(secret))
+	if !ok || subtle.ConstantTimeCompare([]byte(info.KeyHash), []byte(HashApiKey(secret))) != 1 {
+		return ApiKeyInfo{}, false
+	}
+	return info, true
+}
+
+// ListApiKeys 返回所有通过管理接口创建的API-KEY
+func ListApiKeys() []ApiKeyInfo {
+	apiKeysMutex.Lock()
+	defer apiKeysMutex.Unlock()
+
+	keys := []ApiKeyInfo{}
+	for _, info := range apiKeys {
+		keys = append(keys, *info)
+	}
+	return keys
+}
+
+// AddApiKey 创建API-KEY,secret 为空时自动生成,返回创建的API-KEY与完整密钥
+func AddApiKey(info ApiKeyInfo, secret string) (ApiKeyInfo, string, error) {
+	apiKeysMutex.Lock()
+	defer apiKeysMutex.Unlock()
+
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		secret = "sk-" + random.GenerateKey()
+	}
+	info.Id = ApiKeyId(secret)
+	info.KeyHash = HashApiKey(secret)
+	info.MaskedKey = MaskApiKey(secret)
+	if findApiKeyLocked(info.Id) != nil {
+		return ApiKeyInfo{}, "", ErrApiKeyExists
+	}
+	info.CreatedAt = time.Now()
+	if err := DB.Create(&info).Error; err != nil {
+		return ApiKeyInfo{}, "", err
+	}
+	apiKeys = append(apiKeys, &info)
+	return info, secret, nil
+}
+
+// UpdateApiKey 修改API-KEY的设置,update 中修改的是副本,返回错误时不保存
+func UpdateApiKey(id string, update func(info *ApiKeyInfo) error) (ApiKeyInfo, error) {
+	apiKeysMutex.Lock()
+	defer apiKeysMutex.Unlock()
+
+	info := findApiKeyLocked(id)
+	if info == nil {
+		return ApiKeyInfo{}, ErrApiKeyNotFound
+	}
+	updated := *info
+	if err := update(&updated); err != nil {
+		return ApiKeyInfo{}, err
+	}
+	updated.Id = info.Id
+	updated.KeyHash = info.KeyHash
+	updated.MaskedKey = info.MaskedKey
+	updated.CreatedAt = info.CreatedAt
+	if err := DB.Save(&updated).Error; err != nil {
+		return ApiKeyInfo{}, err
+	}
+	*info = updated
+	return updated, nil
+}
+
+// DeleteApiKey 删除API-KEY,用量记录一并删除
+func DeleteApiKey(id string) error {
+	apiKeysMutex.Lock()
+	defer apiKeysMutex.Unlock()
+
+	for i, info := range apiKeys {
+		if info.Id != id {
+			continue
+		}
+		err := DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("api_key = ?", id).Delete(&apiKeyUsageRecord{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&ApiKeyInfo{Id: id}).Error
+		})
+		if err != nil {
+			return err
+		}
+		apiKeys = append(apiKeys[:i], apiKeys[i+1:]...)
+		delete(apiKeyUsage, id)
+		dropPendingUsage(id)
+		delete(apiKeyWindows, id)
+		return nil
+	}
+	return ErrApiKeyNotFound
+}
+
+// dropPendingUsage 丢弃已删除API-KEY尚未写入的用量
+func dropPendingUsage(keyId string) {
+	pendingUsageMutex.Lock()
+	defer pendingUsageMutex.Unlock()
+	for id := range pendingUsage {
+		if id.KeyId == keyId {
+			delete(pendingUsage, id)
+		}
+	}
+}
+
+// AllowApiKeyRequest 按每分钟请求数上限检查并记录一次请求,limit 为0时不限制
+func AllowApiKeyRequest(keyId string, limit int) bool {
+	if limit <= 0 {
+		return true
+	}
+	apiKeysMutex.Lock()
+	defer apiKeysMutex.Unlock()
+
+	now := time.Now()
+	window := apiKeyWindows[keyId][:0]
+	for _, t := range apiKeyWindows[keyId] {
+		if now.Sub(t) < time.Minute {
+			window = append(window, t)
+		}
+	}
+	if len(window) >= limit {
+		apiKeyWindows[keyId] = window
+		return false
+	}
+	apiKeyWindows[keyId] = append(window, now)
+	return true
+}
+
+// usageLocked 返回当日的用量记录,日期变化时清零当日用量,调用方需持有 apiKeysMutex
+func usageLocked(keyId string) *ApiKeyUsage {
+	today := time.Now().Format(usageDateLayout)
+	usage, ok := apiKeyUsage[keyId]
+	if !ok {
+		usage = &ApiKeyUsage{KeyId: keyId}
+		apiKeyUsage[keyId] = usage
+	}
+	if usage.Date != today {
+		usage.Date = today
+		usage.Requests = 0
+		usage.PromptTokens = 0
+		usage.CompletionTokens = 0
+	}
+	return usage
+}
+
+// RecordApiKeyUsage 按API-KEY的ID记录一次请求的token数,未携带API-KEY的请求不记录。
+// 用量先计入内存,由 FlushApiKeyUsage 批量写入数据库
+func RecordApiKeyUsage(keyId string, promptTokens, completionTokens int) {
+	if keyId == "" {
+		return
+	}
+	apiKeysMutex.Lock()
+	usage := usageLocked(keyId)
+	usage.Requests++
+	usage.PromptTokens += promptTokens
+	usage.CompletionTokens += completionTokens
+	usage.TotalRequests++
+	usage.TotalPromptTokens += int64(promptTokens)
+	usage.TotalCompletionTokens += int64(completionTokens)
+	date := usage.Date
+	apiKeysMutex.Unlock()
+
+	queueApiKeyUsage(apiKeyUsageRecord{
+		KeyId:            keyId,
+		Date:             date,
+		Requests:         1,
+		PromptTokens:     int64(promptTokens),
+		CompletionTokens: int64(completionTokens),
+	})
+}
+
+func queueApiKeyUsage(record apiKeyUsageRecord) {
+	pendingUsageMutex.Lock()
+	defer pendingUsageMutex.Unlock()
+
+	id := apiKeyUsageId{KeyId: record.KeyId, Date: record.Date}
+	pending, ok := pendingUsage[id]
+	if !ok {
+		pendingUsage[id] = &record
+		return
+	}
+	pending.Requests += record.Requests
+	pending.PromptTokens += record.PromptTokens
+	pending.CompletionTokens += record.CompletionTokens
+}
+
+// FlushApiKeyUsage 将内存中累计的用量在一个事务中写入数据库,写入失败的用量留待下次写入
+func FlushApiKeyUsage() error {
+	pendingUsageMutex.Lock()
+	records := make([]apiKeyUsageRecord, 0, len(pendingUsage))
+	for _, record := range pendingUsage {
+		records = append(records, *record)
+	}
+	pendingUsage = map[apiKeyUsageId]*apiKeyUsageRecord{}
+	pendingUsageMutex.Unlock()
+
+	if len(records) == 0 {
+		return nil
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		for _, record := range records {
+			if err := addApiKeyUsage(tx, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		for _, record := range records {
+			queueApiKeyUsage(record)
+		}
+	}
+	return err
+}
+
+// addApiKeyUsage 将用量累加到当天的汇总记录
+func addApiKeyUsage(db *gorm.DB, record apiKeyUsageRecord) error {
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "api_key"}, {Name: "date"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"requests":          gorm.Expr("requests + ?", record.Requests),
+			"prompt_tokens":     gorm.Expr("prompt_tokens + ?", record.PromptTokens),
+			"completion_tokens": gorm.Expr("completion_tokens + ?", record.CompletionTokens),
+		}),
+	}).Create(&record).Error
+}
+
+// ApiKeyRemainingTokens 返回API-KEY当日剩余的token数,未限制时返回-1
+func ApiKeyRemainingTokens(keyId string) int {
+	apiKeysMutex.Lock()
+	defer apiKeysMutex.Unlock()
+
+	info := findApiKeyLocked(keyId)
+	if info == nil || info.DailyTokens <= 0 {
+		return -1
+	}
+	return max(info.DailyTokens-usageLocked(keyId).Tokens(), 0)
+}
+
+// ListApiKeyUsage 返回各API-KEY的用量,包括环境变量 API_SECRET 中的API-KEY
+func ListApiKeyUsage() []ApiKeyUsage {
+	apiKeysMutex.Lock()
+	defer apiKeysMutex.Unlock()
+
+	usages := []ApiKeyUsage{}
+	for keyId := range apiKeyUsage {
+		usages = append(usages, *usageLocked(keyId))
+	}
+	sort.Slice(usages, func(i, j int) bool {
+		return usages[i].KeyId < usages[j].KeyId
+	})
+	return usages
+}
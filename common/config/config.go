@@ -3,6 +3,7 @@ package config
 import (
 	"errors"
 	"getbind2api/common/env"
+	"github.com/samber/lo"
 	"math/rand"
 	"os"
 	"strings"
@@ -18,25 +19,74 @@ var MysqlDsn = os.Getenv("MYSQL_DSN")
 var IpBlackList = strings.Split(os.Getenv("IP_BLACK_LIST"), ",")
 var DebugSQLEnabled = strings.ToLower(os.Getenv("DEBUG_SQL")) == "true"
 var ProxyUrl = env.String("PROXY_URL", "")
-var UserAgent = env.String("USER_AGENT", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome")
+
+// 上游地址(可指向镜像/mock服务)
+var UpstreamBaseUrl = strings.TrimSuffix(env.String("UPSTREAM_BASE_URL", "https://api.getbind.co"), "/")
+var UpstreamChatUrl = env.String("UPSTREAM_CHAT_URL", "")
+var UpstreamUploadUrl = env.String("UPSTREAM_UPLOAD_URL", "")
+var UpstreamOrigin = strings.TrimSuffix(env.String("UPSTREAM_ORIGIN", "https://copilot.getbind.co"), "/")
+
+// --mock-upstream 模式下 mock 服务的监听地址
+var MockUpstreamAddr = env.String("MOCK_UPSTREAM_ADDR", "127.0.0.1:0")
+
+// 浏览器指纹(JA3、User-Agent与请求头),random 为每次请求随机选择,账号单独设置的指纹优先
+var FingerprintProfile = env.String("FINGERPRINT_PROFILE", "chrome_135")
+
+// 被 Cloudflare 拦截时更换路线(代理或浏览器指纹)重试的次数,以及被拦截的代理/指纹暂停使用的时长(秒)
+var CloudflareMaxRetries = env.Int("CLOUDFLARE_MAX_RETRIES", 3)
+var CloudflareBenchDuration = env.Int("CLOUDFLARE_BENCH_DURATION", 30*60)
 var CheatEnabled = env.Bool("CHEAT_ENABLED", false)
 var CheatUrl = env.String("CHEAT_URL", "https://kl.goeast.io/kilo/cheat")
 var ChatMaxDays = env.Int("CHAT_MAX_DAYS", -1)
 var ApiSecret = os.Getenv("API_SECRET")
 var ApiSecrets = strings.Split(os.Getenv("API_SECRET"), ",")
 
+// 各API-KEY可使用的模型,格式为 key1:model1|model2;key2:*,未配置的API-KEY可使用全部模型。按API-KEY的ID保存,
+// apiKeyModels 为别名统一为对外的模型名后的结果,见 ResolveApiKeyModels
+var (
+	apiKeyModelsEnv = parseApiKeyModels(os.Getenv("API_KEY_MODELS"))
+	apiKeyModels    = apiKeyModelsEnv
+	apiKeyModelsMu  sync.RWMutex
+)
+
+// 数据目录,用于保存cookie池等运行状态
+var DataPath = env.String("DATA_PATH", ".")
+
 var RateLimitCookieLockDuration = env.Int("RATE_LIMIT_COOKIE_LOCK_DURATION", 10*60)
 
+// cookie选择策略(random/round_robin/least_in_flight/weighted/sticky)及单账号默认并发上限(0为不限制)
+var CookieSelectStrategy = env.String("COOKIE_SELECT_STRATEGY", CookieStrategyRandom)
+var CookieMaxConcurrency = env.Int("COOKIE_MAX_CONCURRENCY", 0)
+
+// 账号健康检查间隔(秒),为0时不开启
+var HealthCheckInterval = env.Int("HEALTH_CHECK_INTERVAL", 0)
+var HealthCheckModel = env.String("HEALTH_CHECK_MODEL", "gpt-4o-mini")
+
 // 隐藏思考过程
 var ReasoningHide = env.Int("REASONING_HIDE", 0)
 
 // 前置message
 var PRE_MESSAGES_JSON = env.String("PRE_MESSAGES_JSON", "")
 
+// 是否将图片与文档上传至上游。上传接口尚未对照真实上游验证,默认关闭,关闭时只接受纯文本文件
+var FileUploadEnable = env.Bool("FILE_UPLOAD_ENABLE", false)
+
+// 图片与文档输入大小上限(MB),远程文件下载时同样受此限制
+var ImageMaxSize = env.Int("IMAGE_MAX_SIZE", 10)
+var TextMaxSize = env.Int("TEXT_MAX_SIZE", 2)
+var DocumentMaxSize = env.Int("DOCUMENT_MAX_SIZE", 20)
+
+// 提示词超出上下文窗口时的裁剪策略[reject、drop_oldest、summarize],为空时不检查
+var ContextTrimStrategy = env.String("CONTEXT_TRIM_STRATEGY", "")
+
+// 多轮对话会话缓存有效期(秒),为0时不开启
+var SessionCacheTTL = env.Int("SESSION_CACHE_TTL", 0)
+
 // 路由前缀
 var RoutePrefix = env.String("ROUTE_PREFIX", "")
 var SwaggerEnable = os.Getenv("SWAGGER_ENABLE")
 var BackendApiEnable = env.Int("BACKEND_API_ENABLE", 1)
+var MetricsEnable = env.Int("METRICS_ENABLE", 1)
 
 var DebugEnabled = os.Getenv("DEBUG") == "true"
 
@@ -57,44 +107,174 @@ var (
 	rateLimitCookies sync.Map // 使用 sync.Map 管理限速 Cookie
 )
 
-func AddRateLimitCookie(cookie string, expirationTime time.Time) {
+// AddRateLimitCookie 锁定被限流的cookie,并持久化锁定状态
+func AddRateLimitCookie(cookie string, expirationTime time.Time) error {
 	rateLimitCookies.Store(cookie, RateLimitCookie{
 		ExpirationTime: expirationTime,
 	})
 	//fmt.Printf("Storing cookie: %s with value: %+v\n", cookie, RateLimitCookie{ExpirationTime: expirationTime})
+	return persistCookies(cookie)
 }
 
 var (
-	GBCookies    []string   // 存储所有的 cookies
+	GBCookies    []string   // 存储所有可用(未禁用)的 cookies
 	cookiesMutex sync.Mutex // 保护 GBCookies 的互斥锁
 )
 
-func InitSGCookies() {
+// InitSGCookies 合并持久化的cookie池状态与环境变量 USER_ID 中的cookie
+func InitSGCookies() error {
+	userIds, err := initCookiePool()
+	if err != nil {
+		return err
+	}
+	return persistCookies(userIds...)
+}
+
+// initCookiePool 加载cookie池,返回需要同步至数据库的cookie(数据库与环境变量中的全部cookie)
+func initCookiePool() ([]string, error) {
 	cookiesMutex.Lock()
 	defer cookiesMutex.Unlock()
 
-	GBCookies = []string{}
+	state, err := loadCookiePool()
+	if err != nil {
+		return nil, err
+	}
+	userIds := append([]string{}, state.Deleted...)
 
-	// 从环境变量中读取 GB_COOKIE 并拆分为切片
-	cookieStr := os.Getenv("USER_ID")
-	if cookieStr != "" {
+	// 从环境变量中读取 USER_ID 并拆分为切片
+	envCookies := map[string]bool{}
+	var envCookieList []string
+	for _, cookie := range strings.Split(os.Getenv("USER_ID"), ",") {
+		cookie = strings.TrimSpace(cookie)
+		if cookie != "" && !envCookies[cookie] {
+			envCookies[cookie] = true
+			envCookieList = append(envCookieList, cookie)
+		}
+	}
 
-		for _, cookie := range strings.Split(cookieStr, ",") {
-			GBCookies = append(GBCookies, cookie)
+	cookiePool = []*CookieInfo{}
+	deletedCookies = map[string]bool{}
+	nextCookiePosition = 0
+	for _, info := range state.Cookies {
+		userIds = append(userIds, info.UserId)
+		nextCookiePosition = max(nextCookiePosition, info.position+1)
+	}
+	for _, cookie := range state.Deleted {
+		if envCookies[cookie] {
+			deletedCookies[cookie] = true
+		}
+	}
+
+	for i := range state.Cookies {
+		info := state.Cookies[i]
+		if info.UserId == "" || findCookieLocked(info.UserId) != nil {
+			continue
+		}
+		// 已从环境变量中移除的cookie不再加载
+		if info.Source == CookieSourceEnv && !envCookies[info.UserId] {
+			continue
+		}
+		if info.RateLimitUntil != nil && info.RateLimitUntil.After(time.Now()) {
+			rateLimitCookies.Store(info.UserId, RateLimitCookie{ExpirationTime: *info.RateLimitUntil})
 		}
+		info.RateLimitUntil = nil
+		cookiePool = append(cookiePool, &info)
 	}
+
+	for _, cookie := range envCookieList {
+		if deletedCookies[cookie] || findCookieLocked(cookie) != nil {
+			continue
+		}
+		cookiePool = append(cookiePool, &CookieInfo{
+			UserId:   cookie,
+			Source:   CookieSourceEnv,
+			position: nextCookiePosition,
+		})
+		nextCookiePosition++
+		userIds = append(userIds, cookie)
+	}
+
+	refreshGBCookiesLocked()
+	return userIds, nil
+}
+
+func parseApiKeyModels(value string) map[string][]string {
+	keyModels := map[string][]string{}
+	for _, item := range strings.Split(value, ";") {
+		key, models, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok || key == "" {
+			continue
+		}
+		keyId := ApiKeyId(key)
+		for _, model := range strings.Split(models, "|") {
+			if model = strings.TrimSpace(model); model != "" {
+				keyModels[keyId] = append(keyModels[keyId], model)
+			}
+		}
+	}
+	return keyModels
+}
+
+// ResolveApiKeyModels 将 API_KEY_MODELS 中的模型名(可以是别名)统一为对外的模型名,
+// resolve 返回模型对外的模型名,不支持的模型原样保留并返回。加载与重新加载模型列表后调用
+func ResolveApiKeyModels(resolve func(model string) (string, bool)) []string {
+	var unknown []string
+	resolved := make(map[string][]string, len(apiKeyModelsEnv))
+	for keyId, models := range apiKeyModelsEnv {
+		for _, model := range models {
+			if model != "*" {
+				if id, ok := resolve(model); ok {
+					model = id
+				} else {
+					unknown = append(unknown, model)
+				}
+			}
+			if !lo.Contains(resolved[keyId], model) {
+				resolved[keyId] = append(resolved[keyId], model)
+			}
+		}
+	}
+
+	apiKeyModelsMu.Lock()
+	apiKeyModels = resolved
+	apiKeyModelsMu.Unlock()
+	return unknown
+}
+
+// ApiKeyAllowsModel 判断API-KEY是否可以使用该模型,keyId 为API-KEY的ID,model 为对外的模型名。
+// 通过管理接口创建的API-KEY以其 Models 为准,其余按 API_KEY_MODELS 判断
+func ApiKeyAllowsModel(keyId, model string) bool {
+	apiKeyModelsMu.RLock()
+	models, ok := apiKeyModels[keyId]
+	apiKeyModelsMu.RUnlock()
+	if info, stored := GetApiKey(keyId); stored {
+		models, ok = info.Models, len(info.Models) > 0
+	}
+	if !ok {
+		return true
+	}
+	for _, allowed := range models {
+		if allowed == "*" || allowed == model {
+			return true
+		}
+	}
+	return false
 }
 
 type CookieManager struct {
 	Cookies      []string
+	StickyKey    string // sticky 策略下用于固定账号的API-KEY
+	Preferred    string // 优先使用的cookie(如多轮对话命中的上游会话所属账号),不可用时按策略选择
 	currentIndex int
+	tried        map[string]bool // 本次请求已尝试过的cookie
+	settings     map[string]cookieSettings
 	mu           sync.Mutex
 }
 
 // GetSGCookies 获取 GBCookies 的副本
 func GetGBCookies() []string {
-	//cookiesMutex.Lock()
-	//defer cookiesMutex.Unlock()
+	cookiesMutex.Lock()
+	defer cookiesMutex.Unlock()
 
 	// 返回 GBCookies 的副本，避免外部直接修改
 	cookiesCopy := make([]string, len(GBCookies))
@@ -171,7 +351,7 @@ func RemoveCookie(cookieToRemove string) {
 
 	// 创建一个新的切片，过滤掉需要删除的 cookie
 	var newCookies []string
-	for _, cookie := range GetGBCookies() {
+	for _, cookie := range GBCookies {
 		if cookie != cookieToRemove {
 			newCookies = append(newCookies, cookie)
 		}
@@ -0,0 +1,34 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveApiKeyModels(t *testing.T) {
+	savedEnv, saved := apiKeyModelsEnv, apiKeyModels
+	t.Cleanup(func() { apiKeyModelsEnv, apiKeyModels = savedEnv, saved })
+
+	apiKeyModelsEnv = parseApiKeyModels("sk-a:alias|model|unknown;sk-b:*")
+	unknown := ResolveApiKeyModels(func(model string) (string, bool) {
+		switch model {
+		case "alias", "model":
+			return "model", true
+		}
+		return "", false
+	})
+	if !reflect.DeepEqual(unknown, []string{"unknown"}) {
+		t.Errorf("unknown = %v", unknown)
+	}
+
+	keyA, keyB := ApiKeyId("sk-a"), ApiKeyId("sk-b")
+	if want := []string{"model", "unknown"}; !reflect.DeepEqual(apiKeyModels[keyA], want) {
+		t.Errorf("models = %v, want %v", apiKeyModels[keyA], want)
+	}
+	if !ApiKeyAllowsModel(keyA, "model") || ApiKeyAllowsModel(keyA, "alias") || ApiKeyAllowsModel(keyA, "other") {
+		t.Error("sk-a should only allow the resolved model")
+	}
+	if !ApiKeyAllowsModel(keyB, "other") || !ApiKeyAllowsModel(ApiKeyId("sk-c"), "other") {
+		t.Error("sk-b and unconfigured keys should allow all models")
+	}
+}
@@ -0,0 +1,387 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// cookie来源
+const (
+	CookieSourceEnv = "env" // 环境变量 USER_ID
+	CookieSourceApi = "api" // 管理接口添加
+)
+
+// cookie健康状态
+const (
+	CookieStatusUnknown        = ""
+	CookieStatusHealthy        = "healthy"
+	CookieStatusRateLimited    = "rate_limited"
+	CookieStatusInvalid        = "invalid"
+	CookieStatusUsageExhausted = "usage_exhausted"
+	CookieStatusError          = "error" // 探测失败,原因与账号无关(如上游503)
+)
+
+var ErrCookieNotFound = errors.New("cookie not found")
+
+// CookieInfo cookie池中单个账号的状态
+type CookieInfo struct {
+	UserId         string     `json:"user_id"`
+	Source         string     `json:"source"`
+	Disabled       bool       `json:"disabled"`
+	RateLimitUntil *time.Time `json:"rate_limit_until,omitempty"`
+	Status         string     `json:"status,omitempty"`
+	StatusMessage  string     `json:"status_message,omitempty"`
+	CheckedAt      *time.Time `json:"checked_at,omitempty"`
+	Weight         int        `json:"weight,omitempty"`          // weighted 策略下的权重,默认为1
+	MaxConcurrency int        `json:"max_concurrency,omitempty"` // 并发上限,默认为 COOKIE_MAX_CONCURRENCY
+	Profile        string     `json:"profile,omitempty"`         // 浏览器指纹,默认为 FINGERPRINT_PROFILE
+	InFlight       int        `json:"in_flight,omitempty"`       // 进行中的请求数,不持久化
+	position       int        // 在 cookies 表中的排序
+}
+
+// Quarantined 账号失效或额度用尽时不再参与请求
+func (info CookieInfo) Quarantined() bool {
+	return info.Status == CookieStatusInvalid || info.Status == CookieStatusUsageExhausted
+}
+
+// cookiePoolState 持久化的cookie池状态
+type cookiePoolState struct {
+	Cookies []CookieInfo `json:"cookies"`
+	Deleted []string     `json:"deleted,omitempty"` // 已删除的环境变量cookie,重启后不再加载
+}
+
+// cookieRecord cookies 表,按 Position 保存添加顺序
+type cookieRecord struct {
+	UserId         string `gorm:"primaryKey;size:255"`
+	Position       int
+	Source         string `gorm:"size:16"`
+	Disabled       bool
+	Deleted        bool // 已删除的环境变量cookie
+	RateLimitUntil *time.Time
+	Status         string `gorm:"size:32"`
+	StatusMessage  string `gorm:"type:text"`
+	CheckedAt      *time.Time
+	Weight         int
+	MaxConcurrency int
+	Profile        string `gorm:"size:64"`
+}
+
+func (cookieRecord) TableName() string {
+	return "cookies"
+}
+
+var (
+	cookiePool         []*CookieInfo // 按添加顺序保存所有cookie,受 cookiesMutex 保护
+	deletedCookies     = map[string]bool{}
+	nextCookiePosition int
+
+	// cookieWriteMutex 保证同一cookie的写入按顺序落库,写库时不持有 cookiesMutex
+	cookieWriteMutex sync.Mutex
+)
+
+// loadCookiePool 读取持久化的cookie池状态
+func loadCookiePool() (cookiePoolState, error) {
+	var state cookiePoolState
+	var records []cookieRecord
+	if err := DB.Order("position").Find(&records).Error; err != nil {
+		return state, err
+	}
+	for _, record := range records {
+		if record.Deleted {
+			state.Deleted = append(state.Deleted, record.UserId)
+			continue
+		}
+		state.Cookies = append(state.Cookies, CookieInfo{
+			UserId:         record.UserId,
+			Source:         record.Source,
+			Disabled:       record.Disabled,
+			RateLimitUntil: record.RateLimitUntil,
+			Status:         record.Status,
+			StatusMessage:  record.StatusMessage,
+			CheckedAt:      record.CheckedAt,
+			Weight:         record.Weight,
+			MaxConcurrency: record.MaxConcurrency,
+			Profile:        record.Profile,
+			position:       record.Position,
+		})
+	}
+	return state, nil
+}
+
+// persistCookies 将指定cookie的当前状态写入数据库:存在的cookie更新对应行,
+// 已删除的环境变量cookie标记为删除,其余删除对应行
+func persistCookies(userIds ...string) error {
+	cookieWriteMutex.Lock()
+	defer cookieWriteMutex.Unlock()
+
+	// 在写锁内读取最新状态,先获得写锁的调用方不会覆盖之后的修改
+	var records []cookieRecord
+	var removed []string
+	cookiesMutex.Lock()
+	for _, userId := range userIds {
+		if info := findCookieLocked(userId); info != nil {
+			records = append(records, newCookieRecord(snapshotCookie(info), info.position))
+		} else if deletedCookies[userId] {
+			records = append(records, cookieRecord{UserId: userId, Source: CookieSourceEnv, Deleted: true})
+		} else {
+			removed = append(removed, userId)
+		}
+	}
+	cookiesMutex.Unlock()
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := upsertCookieRecords(tx, records); err != nil {
+			return err
+		}
+		if len(removed) == 0 {
+			return nil
+		}
+		return tx.Where("user_id IN ?", removed).Delete(&cookieRecord{}).Error
+	})
+}
+
+func newCookieRecord(info CookieInfo, position int) cookieRecord {
+	return cookieRecord{
+		UserId:         info.UserId,
+		Position:       position,
+		Source:         info.Source,
+		Disabled:       info.Disabled,
+		RateLimitUntil: info.RateLimitUntil,
+		Status:         info.Status,
+		StatusMessage:  info.StatusMessage,
+		CheckedAt:      info.CheckedAt,
+		Weight:         info.Weight,
+		MaxConcurrency: info.MaxConcurrency,
+		Profile:        info.Profile,
+	}
+}
+
+func upsertCookieRecords(db *gorm.DB, records []cookieRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		UpdateAll: true,
+	}).CreateInBatches(records, 100).Error
+}
+
+// snapshotCookie 复制cookie状态并附带未过期的限流锁定时间
+func snapshotCookie(info *CookieInfo) CookieInfo {
+	snapshot := *info
+	snapshot.RateLimitUntil = nil
+	snapshot.InFlight = 0
+	if value, ok := rateLimitCookies.Load(info.UserId); ok {
+		if rateLimitCookie, ok := value.(RateLimitCookie); ok && rateLimitCookie.ExpirationTime.After(time.Now()) {
+			expirationTime := rateLimitCookie.ExpirationTime
+			snapshot.RateLimitUntil = &expirationTime
+		}
+	}
+	return snapshot
+}
+
+// refreshGBCookiesLocked 根据cookie池重新生成可用的 GBCookies,调用方需持有 cookiesMutex
+func refreshGBCookiesLocked() {
+	cookies := []string{}
+	for _, info := range cookiePool {
+		if !info.Disabled && !info.Quarantined() {
+			cookies = append(cookies, info.UserId)
+		}
+	}
+	GBCookies = cookies
+}
+
+func findCookieLocked(userId string) *CookieInfo {
+	for _, info := range cookiePool {
+		if info.UserId == userId {
+			return info
+		}
+	}
+	return nil
+}
+
+// ListCookies 返回cookie池中所有cookie的状态
+func ListCookies() []CookieInfo {
+	cookiesMutex.Lock()
+	defer cookiesMutex.Unlock()
+
+	cookies := []CookieInfo{}
+	for _, info := range cookiePool {
+		snapshot := snapshotCookie(info)
+		snapshot.InFlight = CookieInFlight(info.UserId)
+		cookies = append(cookies, snapshot)
+	}
+	return cookies
+}
+
+// AddCookies 添加cookie,已存在的cookie会被忽略,返回实际新增的cookie
+func AddCookies(userIds []string) ([]string, error) {
+	added := addCookies(userIds)
+	if len(added) == 0 {
+		return added, nil
+	}
+	return added, persistCookies(added...)
+}
+
+func addCookies(userIds []string) []string {
+	cookiesMutex.Lock()
+	defer cookiesMutex.Unlock()
+
+	added := []string{}
+	for _, userId := range userIds {
+		userId = strings.TrimSpace(userId)
+		if userId == "" || findCookieLocked(userId) != nil {
+			continue
+		}
+		cookiePool = append(cookiePool, &CookieInfo{
+			UserId:   userId,
+			Source:   CookieSourceApi,
+			position: nextCookiePosition,
+		})
+		nextCookiePosition++
+		delete(deletedCookies, userId)
+		added = append(added, userId)
+	}
+	refreshGBCookiesLocked()
+	return added
+}
+
+// SetCookieDisabled 禁用或启用cookie,启用时同时解除限流锁定和隔离状态
+func SetCookieDisabled(userId string, disabled bool) error {
+	err := updateCookie(userId, func(info *CookieInfo) {
+		info.Disabled = disabled
+		if !disabled {
+			rateLimitCookies.Delete(userId)
+			info.Status = CookieStatusUnknown
+			info.StatusMessage = ""
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return persistCookies(userId)
+}
+
+// updateCookie 在 cookiesMutex 内修改cookie状态并刷新可用的 GBCookies
+func updateCookie(userId string, update func(info *CookieInfo)) error {
+	cookiesMutex.Lock()
+	defer cookiesMutex.Unlock()
+
+	info := findCookieLocked(userId)
+	if info == nil {
+		return ErrCookieNotFound
+	}
+	update(info)
+	refreshGBCookiesLocked()
+	return nil
+}
+
+// SetCookieSettings 设置cookie的权重、并发上限与浏览器指纹,为nil的字段保持不变,设置为0或空字符串时恢复默认值
+func SetCookieSettings(userId string, weight, maxConcurrency *int, profile *string) error {
+	err := updateCookie(userId, func(info *CookieInfo) {
+		if weight != nil {
+			info.Weight = *weight
+		}
+		if maxConcurrency != nil {
+			info.MaxConcurrency = *maxConcurrency
+		}
+		if profile != nil {
+			info.Profile = *profile
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return persistCookies(userId)
+}
+
+// CookieProfile 返回账号单独设置的浏览器指纹,未设置时返回空字符串
+func CookieProfile(userId string) string {
+	cookiesMutex.Lock()
+	defer cookiesMutex.Unlock()
+
+	if info := findCookieLocked(userId); info != nil {
+		return info.Profile
+	}
+	return ""
+}
+
+// DeleteCookie 从cookie池中删除cookie
+func DeleteCookie(userId string) error {
+	if err := deleteCookie(userId); err != nil {
+		return err
+	}
+	return persistCookies(userId)
+}
+
+func deleteCookie(userId string) error {
+	cookiesMutex.Lock()
+	defer cookiesMutex.Unlock()
+
+	index := -1
+	for i, info := range cookiePool {
+		if info.UserId == userId {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		return ErrCookieNotFound
+	}
+
+	if cookiePool[index].Source == CookieSourceEnv {
+		deletedCookies[userId] = true
+	}
+	cookiePool = append(cookiePool[:index], cookiePool[index+1:]...)
+	rateLimitCookies.Delete(userId)
+
+	refreshGBCookiesLocked()
+	return nil
+}
+
+// SetCookieStatus 记录cookie的健康状态,失效或额度用尽的cookie会被隔离,
+// 恢复健康的cookie同时解除限流锁定,立即重新参与请求
+func SetCookieStatus(userId, status, message string) error {
+	checkedAt := time.Now()
+	err := updateCookie(userId, func(info *CookieInfo) {
+		info.Status = status
+		info.StatusMessage = message
+		info.CheckedAt = &checkedAt
+		if status == CookieStatusHealthy {
+			rateLimitCookies.Delete(userId)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return persistCookies(userId)
+}
+
+// CookiePoolStats cookie池统计
+type CookiePoolStats struct {
+	Total     int // 账号总数
+	Available int // 未禁用且未被隔离的账号数
+	Locked    int // 因限流被锁定的账号数
+}
+
+// GetCookiePoolStats 统计cookie池中各状态的账号数
+func GetCookiePoolStats() CookiePoolStats {
+	cookiesMutex.Lock()
+	defer cookiesMutex.Unlock()
+
+	stats := CookiePoolStats{
+		Total:     len(cookiePool),
+		Available: len(GBCookies),
+	}
+	for _, info := range cookiePool {
+		if snapshotCookie(info).RateLimitUntil != nil {
+			stats.Locked++
+		}
+	}
+	return stats
+}
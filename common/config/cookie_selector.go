@@ -0,0 +1,190 @@
+package config
+
+import (
+	"errors"
+	"github.com/samber/lo"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+)
+
+// cookie选择策略
+const (
+	CookieStrategyRandom        = "random"          // 随机
+	CookieStrategyRoundRobin    = "round_robin"     // 轮询
+	CookieStrategyLeastInFlight = "least_in_flight" // 进行中请求最少
+	CookieStrategyWeighted      = "weighted"        // 按权重随机
+	CookieStrategySticky        = "sticky"          // 同一API-KEY固定使用同一账号
+)
+
+var (
+	ErrNoCookieAvailable = errors.New("no cookies available")
+	ErrCookiesBusy       = errors.New("all cookies have reached their concurrency limit")
+)
+
+var (
+	inFlightCookies   = map[string]int{} // 每个cookie进行中的请求数
+	inFlightMutex     sync.Mutex
+	roundRobinCounter uint64
+)
+
+// CookieInFlight 返回cookie进行中的请求数
+func CookieInFlight(cookie string) int {
+	inFlightMutex.Lock()
+	defer inFlightMutex.Unlock()
+	return inFlightCookies[cookie]
+}
+
+// cookieSettings 账号的选择权重与并发上限
+type cookieSettings struct {
+	weight         int
+	maxConcurrency int // 0 表示不限制
+}
+
+// getCookieSettings 读取cookie池中各账号的权重和并发上限,未设置时使用默认值
+func getCookieSettings() map[string]cookieSettings {
+	cookiesMutex.Lock()
+	defer cookiesMutex.Unlock()
+
+	settings := make(map[string]cookieSettings, len(cookiePool))
+	for _, info := range cookiePool {
+		setting := defaultCookieSettings()
+		if info.Weight > 0 {
+			setting.weight = info.Weight
+		}
+		if info.MaxConcurrency > 0 {
+			setting.maxConcurrency = info.MaxConcurrency
+		}
+		settings[info.UserId] = setting
+	}
+	return settings
+}
+
+func defaultCookieSettings() cookieSettings {
+	return cookieSettings{weight: 1, maxConcurrency: CookieMaxConcurrency}
+}
+
+// cookieSetting 返回账号的设置,创建 CookieManager 后才加入或已被删除的账号使用默认值
+func (cm *CookieManager) cookieSetting(cookie string) cookieSettings {
+	if setting, ok := cm.settings[cookie]; ok {
+		return setting
+	}
+	return defaultCookieSettings()
+}
+
+// SelectCookie 按 COOKIE_SELECT_STRATEGY 从未尝试过的cookie中选择一个,并占用一个并发名额。
+// 使用完毕后需调用 ReleaseCookie 释放
+func (cm *CookieManager) SelectCookie() (string, error) {
+	cm.mu.Lock()
+	defer cm.mu.Unlock()
+
+	if cm.tried == nil {
+		cm.tried = map[string]bool{}
+	}
+	if cm.settings == nil {
+		cm.settings = getCookieSettings()
+	}
+
+	inFlightMutex.Lock()
+	defer inFlightMutex.Unlock()
+
+	var candidates []string
+	busy := false
+	for _, cookie := range cm.Cookies {
+		if cm.tried[cookie] {
+			continue
+		}
+		if limit := cm.cookieSetting(cookie).maxConcurrency; limit > 0 && inFlightCookies[cookie] >= limit {
+			busy = true
+			continue
+		}
+		candidates = append(candidates, cookie)
+	}
+	if len(candidates) == 0 {
+		if busy {
+			return "", ErrCookiesBusy
+		}
+		return "", ErrNoCookieAvailable
+	}
+
+	cookie := cm.Preferred
+	if cookie == "" || !lo.Contains(candidates, cookie) {
+		cookie = cm.pickCookie(candidates)
+	}
+	cm.tried[cookie] = true
+	inFlightCookies[cookie]++
+	return cookie, nil
+}
+
+// ReleaseCookie 释放 SelectCookie 占用的并发名额
+func (cm *CookieManager) ReleaseCookie(cookie string) {
+	if cookie == "" {
+		return
+	}
+	inFlightMutex.Lock()
+	defer inFlightMutex.Unlock()
+
+	if inFlightCookies[cookie] <= 1 {
+		delete(inFlightCookies, cookie)
+		return
+	}
+	inFlightCookies[cookie]--
+}
+
+// pickCookie 按策略从候选cookie中选择,调用方需持有 inFlightMutex
+func (cm *CookieManager) pickCookie(candidates []string) string {
+	switch CookieSelectStrategy {
+	case CookieStrategyRoundRobin:
+		index := atomic.AddUint64(&roundRobinCounter, 1) - 1
+		return candidates[index%uint64(len(candidates))]
+	case CookieStrategyLeastInFlight:
+		var least []string
+		for _, cookie := range candidates {
+			if len(least) == 0 || inFlightCookies[cookie] < inFlightCookies[least[0]] {
+				least = []string{cookie}
+			} else if inFlightCookies[cookie] == inFlightCookies[least[0]] {
+				least = append(least, cookie)
+			}
+		}
+		return least[rand.Intn(len(least))]
+	case CookieStrategyWeighted:
+		total := 0
+		for _, cookie := range candidates {
+			total += cm.cookieSetting(cookie).weight
+		}
+		// 权重均无效时按随机选择
+		if total <= 0 {
+			break
+		}
+		n := rand.Intn(total)
+		for _, cookie := range candidates {
+			n -= cm.cookieSetting(cookie).weight
+			if n < 0 {
+				return cookie
+			}
+		}
+	case CookieStrategySticky:
+		if cm.StickyKey != "" {
+			return rendezvousPick(cm.StickyKey, candidates)
+		}
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
+
+// rendezvousPick 使用最高随机权重哈希为 key 选择候选项,候选项增减时只影响少量 key 的映射
+func rendezvousPick(key string, candidates []string) string {
+	var selected string
+	var maxScore uint64
+	for _, candidate := range candidates {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		h.Write([]byte{0})
+		h.Write([]byte(candidate))
+		if score := h.Sum64(); selected == "" || score > maxScore {
+			selected = candidate
+			maxScore = score
+		}
+	}
+	return selected
+}
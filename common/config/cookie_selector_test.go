@@ -0,0 +1,165 @@
+package config
+
+import (
+	"errors"
+	"testing"
+)
+
+// setCookiePool 替换cookie池,测试结束后恢复
+func setCookiePool(t *testing.T, infos ...CookieInfo) []string {
+	t.Helper()
+	cookiesMutex.Lock()
+	saved := cookiePool
+	cookiePool = nil
+	var userIds []string
+	for i := range infos {
+		cookiePool = append(cookiePool, &infos[i])
+		userIds = append(userIds, infos[i].UserId)
+	}
+	cookiesMutex.Unlock()
+	t.Cleanup(func() {
+		cookiesMutex.Lock()
+		cookiePool = saved
+		cookiesMutex.Unlock()
+	})
+	return userIds
+}
+
+// setStrategy 设置cookie选择策略,测试结束后恢复
+func setStrategy(t *testing.T, strategy string) {
+	t.Helper()
+	saved := CookieSelectStrategy
+	CookieSelectStrategy = strategy
+	t.Cleanup(func() { CookieSelectStrategy = saved })
+}
+
+// selectAll 依次选出全部cookie并释放,返回选择顺序
+func selectAll(t *testing.T, cm *CookieManager) []string {
+	t.Helper()
+	var selected []string
+	for {
+		cookie, err := cm.SelectCookie()
+		if errors.Is(err, ErrNoCookieAvailable) {
+			return selected
+		}
+		if err != nil {
+			t.Fatalf("SelectCookie: %v", err)
+		}
+		cm.ReleaseCookie(cookie)
+		selected = append(selected, cookie)
+	}
+}
+
+func TestSelectCookieTriesEachCookieOnce(t *testing.T) {
+	for _, strategy := range []string{CookieStrategyRandom, CookieStrategyRoundRobin, CookieStrategyLeastInFlight, CookieStrategyWeighted, CookieStrategySticky} {
+		t.Run(strategy, func(t *testing.T) {
+			setStrategy(t, strategy)
+			cookies := setCookiePool(t, CookieInfo{UserId: "a"}, CookieInfo{UserId: "b"}, CookieInfo{UserId: "c"})
+			selected := selectAll(t, &CookieManager{Cookies: cookies, StickyKey: "key"})
+			if len(selected) != len(cookies) {
+				t.Fatalf("selected = %v, want each of %v once", selected, cookies)
+			}
+			seen := map[string]bool{}
+			for _, cookie := range selected {
+				if seen[cookie] {
+					t.Fatalf("cookie %s selected twice: %v", cookie, selected)
+				}
+				seen[cookie] = true
+			}
+		})
+	}
+}
+
+func TestSelectCookieWeighted(t *testing.T) {
+	setStrategy(t, CookieStrategyWeighted)
+
+	t.Run("zero weight cookies fall back to default weight", func(t *testing.T) {
+		cookies := setCookiePool(t, CookieInfo{UserId: "a"}, CookieInfo{UserId: "b"})
+		// 创建后才加入cookie池的账号没有设置,同样使用默认权重
+		selected := selectAll(t, &CookieManager{Cookies: append(cookies, "new")})
+		if len(selected) != 3 {
+			t.Fatalf("selected = %v", selected)
+		}
+	})
+
+	t.Run("heavier cookie selected more often", func(t *testing.T) {
+		cookies := setCookiePool(t, CookieInfo{UserId: "heavy", Weight: 9}, CookieInfo{UserId: "light", Weight: 1})
+		counts := map[string]int{}
+		for i := 0; i < 2000; i++ {
+			cm := &CookieManager{Cookies: cookies}
+			cookie, err := cm.SelectCookie()
+			if err != nil {
+				t.Fatalf("SelectCookie: %v", err)
+			}
+			cm.ReleaseCookie(cookie)
+			counts[cookie]++
+		}
+		if counts["heavy"] < 1600 {
+			t.Errorf("counts = %v, want heavy selected about 90%% of the time", counts)
+		}
+	})
+}
+
+func TestSelectCookieSticky(t *testing.T) {
+	setStrategy(t, CookieStrategySticky)
+	cookies := setCookiePool(t, CookieInfo{UserId: "a"}, CookieInfo{UserId: "b"}, CookieInfo{UserId: "c"})
+
+	first := ""
+	for i := 0; i < 20; i++ {
+		cm := &CookieManager{Cookies: cookies, StickyKey: "key_1"}
+		cookie, err := cm.SelectCookie()
+		if err != nil {
+			t.Fatalf("SelectCookie: %v", err)
+		}
+		cm.ReleaseCookie(cookie)
+		if first == "" {
+			first = cookie
+		} else if cookie != first {
+			t.Fatalf("sticky key selected %s and %s", first, cookie)
+		}
+	}
+}
+
+func TestSelectCookiePreferred(t *testing.T) {
+	setStrategy(t, CookieStrategyRandom)
+	cookies := setCookiePool(t, CookieInfo{UserId: "a"}, CookieInfo{UserId: "b"}, CookieInfo{UserId: "c"})
+
+	cm := &CookieManager{Cookies: cookies, Preferred: "b"}
+	cookie, err := cm.SelectCookie()
+	if err != nil || cookie != "b" {
+		t.Fatalf("SelectCookie = %s, %v, want b", cookie, err)
+	}
+	cm.ReleaseCookie(cookie)
+
+	// 优先的cookie不在候选中时按策略选择
+	cm = &CookieManager{Cookies: cookies, Preferred: "missing"}
+	if cookie, err = cm.SelectCookie(); err != nil {
+		t.Fatalf("SelectCookie: %v", err)
+	}
+	cm.ReleaseCookie(cookie)
+}
+
+func TestSelectCookieConcurrencyLimit(t *testing.T) {
+	setStrategy(t, CookieStrategyRandom)
+	cookies := setCookiePool(t, CookieInfo{UserId: "limited", MaxConcurrency: 1})
+
+	first := &CookieManager{Cookies: cookies}
+	cookie, err := first.SelectCookie()
+	if err != nil {
+		t.Fatalf("SelectCookie: %v", err)
+	}
+
+	second := &CookieManager{Cookies: cookies}
+	if _, err = second.SelectCookie(); !errors.Is(err, ErrCookiesBusy) {
+		t.Fatalf("err = %v, want %v", err, ErrCookiesBusy)
+	}
+
+	first.ReleaseCookie(cookie)
+	if CookieInFlight(cookie) != 0 {
+		t.Fatalf("in flight = %d after release", CookieInFlight(cookie))
+	}
+	if cookie, err = second.SelectCookie(); err != nil {
+		t.Fatalf("SelectCookie after release: %v", err)
+	}
+	second.ReleaseCookie(cookie)
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"fmt"
+	"getbind2api/common/env"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+const sqliteFileName = "getbind2api.db"
+
+// SQLite 数据库文件路径,默认为数据目录下的 getbind2api.db;设置 MYSQL_DSN 时使用MySQL
+var SQLitePath = env.String("SQLITE_PATH", "")
+var SQLiteBusyTimeout = env.Int("SQLITE_BUSY_TIMEOUT", 3000)
+
+var (
+	DB          *gorm.DB
+	UsingSQLite = false
+	UsingMySQL  = false
+)
+
+// InitDB 连接数据库并执行未完成的迁移
+func InitDB() error {
+	var dialector gorm.Dialector
+	if MysqlDsn != "" {
+		UsingMySQL = true
+		dialector = mysql.Open(MysqlDsn)
+	} else {
+		UsingSQLite = true
+		path := SQLitePath
+		if path == "" {
+			if err := os.MkdirAll(DataPath, 0755); err != nil {
+				return err
+			}
+			path = filepath.Join(DataPath, sqliteFileName)
+		}
+		dialector = sqlite.Open(fmt.Sprintf("%s?_pragma=busy_timeout(%d)&_pragma=journal_mode(WAL)", path, SQLiteBusyTimeout))
+	}
+
+	logLevel := gormlogger.Silent
+	if DebugSQLEnabled {
+		logLevel = gormlogger.Info
+	}
+	db, err := gorm.Open(dialector, &gorm.Config{
+		Logger: gormlogger.Default.LogMode(logLevel),
+	})
+	if err != nil {
+		return fmt.Errorf("open database err: %v", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return err
+	}
+	if UsingSQLite {
+		// SQLite 同一时间只允许一个写入,串行化连接避免 database is locked
+		sqlDB.SetMaxOpenConns(1)
+	} else {
+		sqlDB.SetMaxOpenConns(20)
+		sqlDB.SetMaxIdleConns(5)
+		sqlDB.SetConnMaxLifetime(time.Hour)
+	}
+
+	if err = migrateDB(db); err != nil {
+		return fmt.Errorf("migrate database err: %v", err)
+	}
+	DB = db
+	return nil
+}
+
+// CloseDB 关闭数据库连接
+func CloseDB() error {
+	if DB == nil {
+		return nil
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
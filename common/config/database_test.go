@@ -0,0 +1,78 @@
+package config
+
+import (
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+// initTestDB 在临时目录中创建数据库并执行迁移,测试结束后关闭
+func initTestDB(t *testing.T) {
+	t.Helper()
+	savedPath, savedDB := DataPath, DB
+	DataPath = t.TempDir()
+	if err := InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = CloseDB()
+		DataPath, DB = savedPath, savedDB
+	})
+}
+
+func TestMigrationsCoverModels(t *testing.T) {
+	initTestDB(t)
+	// 迁移使用固定的表结构建表,模型结构新增字段时需追加迁移
+	for _, model := range []interface{}{&cookieRecord{}, &ApiKeyInfo{}, &apiKeyUsageRecord{}, &RequestLog{}} {
+		stmt := &gorm.Statement{DB: DB}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatalf("parse %T: %v", model, err)
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName != "" && !DB.Migrator().HasColumn(model, field.DBName) {
+				t.Errorf("%s.%s has no column after migrations", stmt.Schema.Table, field.DBName)
+			}
+		}
+	}
+}
+
+func TestFlushRequestLogs(t *testing.T) {
+	initTestDB(t)
+	AddRequestLog(RequestLog{RequestId: "req-1", Model: "gpt-4o-mini", StatusCode: 200})
+	AddRequestLog(RequestLog{RequestId: "req-2", Model: "o3-mini", StatusCode: 500})
+
+	logs, err := ListRequestLogs(RequestLogFilter{Limit: 10})
+	if err != nil || len(logs) != 0 {
+		t.Fatalf("logs before flush = %+v, %v, want none", logs, err)
+	}
+	if err = FlushRequestLogs(); err != nil {
+		t.Fatalf("FlushRequestLogs: %v", err)
+	}
+	logs, err = ListRequestLogs(RequestLogFilter{Limit: 10})
+	if err != nil || len(logs) != 2 {
+		t.Fatalf("logs = %+v, %v, want 2", logs, err)
+	}
+	if logs[0].RequestId != "req-2" || logs[1].RequestId != "req-1" || logs[1].CreatedAt.IsZero() {
+		t.Errorf("logs = %+v", logs)
+	}
+}
+
+func TestFlushRequestLogsRetriesOnError(t *testing.T) {
+	initTestDB(t)
+	AddRequestLog(RequestLog{RequestId: "req-retry"})
+	_ = CloseDB()
+	if err := FlushRequestLogs(); err == nil {
+		t.Fatal("FlushRequestLogs on closed database should fail")
+	}
+
+	if err := InitDB(); err != nil {
+		t.Fatalf("InitDB: %v", err)
+	}
+	if err := FlushRequestLogs(); err != nil {
+		t.Fatalf("FlushRequestLogs: %v", err)
+	}
+	logs, err := ListRequestLogs(RequestLogFilter{Limit: 10})
+	if err != nil || len(logs) != 1 || logs[0].RequestId != "req-retry" {
+		t.Fatalf("logs = %+v, %v, want the retried log", logs, err)
+	}
+}
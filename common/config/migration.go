@@ -0,0 +1,140 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// schemaMigration 已执行的迁移
+type schemaMigration struct {
+	Version   int    `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"size:128"`
+	AppliedAt time.Time
+}
+
+func (schemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+type migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+}
+
+// migrations 按版本号顺序执行,已发布的迁移不可修改,表结构变更需追加新的迁移。
+// 迁移使用其版本的表结构(如 v1 的 schemaV1*),不引用会随版本变化的模型结构
+var migrations = []migration{
+	{
+		Version: 1,
+		Name:    "create tables",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&schemaV1Cookie{}, &schemaV1ApiKey{}, &schemaV1ApiKeyUsage{}, &schemaV1RequestLog{})
+		},
+	},
+}
+
+// v1 的表结构
+type schemaV1Cookie struct {
+	UserId         string `gorm:"primaryKey;size:255"`
+	Position       int
+	Source         string `gorm:"size:16"`
+	Disabled       bool
+	Deleted        bool
+	RateLimitUntil *time.Time
+	Status         string `gorm:"size:32"`
+	StatusMessage  string `gorm:"type:text"`
+	CheckedAt      *time.Time
+	Weight         int
+	MaxConcurrency int
+	Profile        string `gorm:"size:64"`
+}
+
+func (schemaV1Cookie) TableName() string {
+	return "cookies"
+}
+
+type schemaV1ApiKey struct {
+	ApiKey      string `gorm:"primaryKey;size:255"`
+	KeyHash     string `gorm:"size:64"`
+	MaskedKey   string `gorm:"size:32"`
+	Name        string `gorm:"size:255"`
+	Models      string `gorm:"type:text"`
+	RateLimit   int
+	DailyTokens int
+	ExpiresAt   *time.Time
+	Disabled    bool
+	CreatedAt   time.Time
+}
+
+func (schemaV1ApiKey) TableName() string {
+	return "api_keys"
+}
+
+type schemaV1ApiKeyUsage struct {
+	ApiKey           string `gorm:"primaryKey;size:255"`
+	Date             string `gorm:"primaryKey;size:10"`
+	Requests         int64
+	PromptTokens     int64
+	CompletionTokens int64
+}
+
+func (schemaV1ApiKeyUsage) TableName() string {
+	return "api_key_usages"
+}
+
+type schemaV1RequestLog struct {
+	Id               int64     `gorm:"primaryKey;autoIncrement"`
+	CreatedAt        time.Time `gorm:"index"`
+	RequestId        string    `gorm:"size:64"`
+	ApiKey           string    `gorm:"size:255;index"`
+	Model            string    `gorm:"size:128;index"`
+	Stream           bool
+	StatusCode       int
+	Cookie           string `gorm:"size:255"`
+	PromptTokens     int
+	CompletionTokens int
+	DurationMs       int64
+	ClientIp         string `gorm:"size:64"`
+}
+
+func (schemaV1RequestLog) TableName() string {
+	return "request_logs"
+}
+
+// migrateDB 执行尚未执行的迁移,每个迁移在单独的事务中执行
+func migrateDB(db *gorm.DB) error {
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		return err
+	}
+	var applied []schemaMigration
+	if err := db.Find(&applied).Error; err != nil {
+		return err
+	}
+	appliedVersions := map[int]bool{}
+	for _, m := range applied {
+		appliedVersions[m.Version] = true
+	}
+
+	for _, m := range migrations {
+		if appliedVersions[m.Version] {
+			continue
+		}
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{
+				Version:   m.Version,
+				Name:      m.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) err: %v", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
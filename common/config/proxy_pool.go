@@ -0,0 +1,210 @@
+package config
+
+import (
+	"fmt"
+	"getbind2api/common/env"
+	"github.com/samber/lo"
+	"math/rand"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 代理选择策略
+const (
+	ProxyStrategySticky     = "sticky"      // 同一账号固定使用同一代理
+	ProxyStrategyRoundRobin = "round_robin" // 轮询
+	ProxyStrategyRandom     = "random"      // 随机
+)
+
+// 代理选择策略,连续失败多少次后暂停使用该代理,以及暂停时长(秒)
+var ProxySelectStrategy = env.String("PROXY_SELECT_STRATEGY", ProxyStrategySticky)
+var ProxyFailThreshold = env.Int("PROXY_FAIL_THRESHOLD", 3)
+var ProxyBenchDuration = env.Int("PROXY_BENCH_DURATION", 5*60)
+
+// ProxyInfo 代理及其健康状态
+type ProxyInfo struct {
+	Url                 string     `json:"url"` // 已隐去密码
+	Requests            int64      `json:"requests"`
+	Failures            int64      `json:"failures"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	LastError           string     `json:"last_error,omitempty"`
+	BenchedUntil        *time.Time `json:"benched_until,omitempty"`
+
+	rawUrl string
+}
+
+// Benched 代理是否处于暂停使用状态
+func (p *ProxyInfo) Benched() bool {
+	return p.BenchedUntil != nil && p.BenchedUntil.After(time.Now())
+}
+
+var (
+	proxyPool         []*ProxyInfo
+	proxyMutex        sync.Mutex
+	proxyRoundRobin   uint64
+	supportedProxyUrl = map[string]bool{"http": true, "https": true, "socks4": true, "socks5": true, "socks5h": true}
+)
+
+// InitProxyPool 解析 PROXY_URL 中以,分隔的代理列表
+func InitProxyPool() error {
+	var pool []*ProxyInfo
+	seen := map[string]bool{}
+	for _, raw := range strings.Split(ProxyUrl, ",") {
+		raw = strings.TrimSpace(raw)
+		if raw == "" || seen[raw] {
+			continue
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			return fmt.Errorf("invalid proxy %s: %v", raw, err)
+		}
+		if !supportedProxyUrl[u.Scheme] || u.Host == "" {
+			return fmt.Errorf("invalid proxy %s: scheme must be one of http, https, socks4, socks5, socks5h", u.Redacted())
+		}
+		seen[raw] = true
+		pool = append(pool, &ProxyInfo{Url: u.Redacted(), rawUrl: raw})
+	}
+
+	proxyMutex.Lock()
+	defer proxyMutex.Unlock()
+	proxyPool = pool
+	return nil
+}
+
+// SelectProxy 按 PROXY_SELECT_STRATEGY 为账号选择代理,未配置代理时返回空字符串。
+// 暂停使用中的代理及 excluded 中的代理仅在没有其他代理可选时才会被选中
+func SelectProxy(userId string, excluded ...string) string {
+	proxyMutex.Lock()
+	defer proxyMutex.Unlock()
+
+	if len(proxyPool) == 0 {
+		return ""
+	}
+	var healthy, available, all []string
+	for _, p := range proxyPool {
+		all = append(all, p.rawUrl)
+		if lo.Contains(excluded, p.rawUrl) {
+			continue
+		}
+		available = append(available, p.rawUrl)
+		if !p.Benched() {
+			healthy = append(healthy, p.rawUrl)
+		}
+	}
+
+	candidates := healthy
+	if len(candidates) == 0 {
+		candidates = available
+	}
+	if len(candidates) == 0 {
+		candidates = all
+	}
+
+	switch ProxySelectStrategy {
+	case ProxyStrategySticky:
+		if userId != "" {
+			return rendezvousPick(userId, candidates)
+		}
+	case ProxyStrategyRoundRobin:
+		index := atomic.AddUint64(&proxyRoundRobin, 1) - 1
+		return candidates[index%uint64(len(candidates))]
+	}
+	return candidates[rand.Intn(len(candidates))]
+}
+
+// ReportProxySuccess 记录代理请求成功,清除连续失败次数
+func ReportProxySuccess(proxyUrl string) {
+	proxyMutex.Lock()
+	defer proxyMutex.Unlock()
+
+	if p := findProxyLocked(proxyUrl); p != nil {
+		p.Requests++
+		p.ConsecutiveFailures = 0
+		p.BenchedUntil = nil
+	}
+}
+
+// ReportProxyFailure 记录代理连接失败,连续失败达到 PROXY_FAIL_THRESHOLD 次时暂停使用该代理,
+// 返回代理是否因此被暂停
+func ReportProxyFailure(proxyUrl, message string) bool {
+	proxyMutex.Lock()
+	defer proxyMutex.Unlock()
+
+	p := findProxyLocked(proxyUrl)
+	if p == nil {
+		return false
+	}
+	p.Requests++
+	p.Failures++
+	p.ConsecutiveFailures++
+	p.LastError = message
+	if ProxyFailThreshold > 0 && p.ConsecutiveFailures >= ProxyFailThreshold && !p.Benched() {
+		benchProxyLocked(p, ProxyBenchDuration)
+		return true
+	}
+	return false
+}
+
+// BenchProxy 立即暂停使用代理(如出口IP被上游拦截)
+func BenchProxy(proxyUrl, message string, seconds int) {
+	proxyMutex.Lock()
+	defer proxyMutex.Unlock()
+
+	if p := findProxyLocked(proxyUrl); p != nil {
+		p.Requests++
+		p.Failures++
+		p.LastError = message
+		benchProxyLocked(p, seconds)
+	}
+}
+
+// ProxyCount 返回代理池中的代理数量
+func ProxyCount() int {
+	proxyMutex.Lock()
+	defer proxyMutex.Unlock()
+	return len(proxyPool)
+}
+
+// benchProxyLocked 暂停使用代理,调用方需持有 proxyMutex
+func benchProxyLocked(p *ProxyInfo, seconds int) {
+	until := time.Now().Add(time.Duration(seconds) * time.Second)
+	p.BenchedUntil = &until
+	p.ConsecutiveFailures = 0
+}
+
+// ListProxies 返回代理池及各代理健康状态的副本
+func ListProxies() []ProxyInfo {
+	proxyMutex.Lock()
+	defer proxyMutex.Unlock()
+
+	proxies := make([]ProxyInfo, 0, len(proxyPool))
+	for _, p := range proxyPool {
+		info := *p
+		if !info.Benched() {
+			info.BenchedUntil = nil
+		}
+		proxies = append(proxies, info)
+	}
+	return proxies
+}
+
+// RedactProxyUrl 隐去代理地址中的密码,用于日志输出
+func RedactProxyUrl(proxyUrl string) string {
+	u, err := url.Parse(proxyUrl)
+	if err != nil {
+		return proxyUrl
+	}
+	return u.Redacted()
+}
+
+func findProxyLocked(proxyUrl string) *ProxyInfo {
+	for _, p := range proxyPool {
+		if p.rawUrl == proxyUrl {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package config
+
+import (
+	"getbind2api/common/env"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 是否记录对话请求日志,以及日志保留天数(0为永久保留)
+var RequestLogEnable = env.Int("REQUEST_LOG_ENABLE", 1)
+var RequestLogRetentionDays = env.Int("REQUEST_LOG_RETENTION_DAYS", 30)
+
+// RequestLog 对话请求日志
+type RequestLog struct {
+	Id               int64     `json:"id" gorm:"primaryKey;autoIncrement"`
+	CreatedAt        time.Time `json:"created_at" gorm:"index"`
+	RequestId        string    `json:"request_id" gorm:"size:64"`
+	KeyId            string    `json:"key_id" gorm:"column:api_key;size:255;index"` // API-KEY的ID,不记录完整密钥
+	Model            string    `json:"model" gorm:"size:128;index"`
+	Stream           bool      `json:"stream"`
+	StatusCode       int       `json:"status_code"`
+	Cookie           string    `json:"cookie,omitempty" gorm:"size:255"` // 最后使用的账号
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	DurationMs       int64     `json:"duration_ms"`
+	ClientIp         string    `json:"client_ip" gorm:"size:64"`
+}
+
+func (RequestLog) TableName() string {
+	return "request_logs"
+}
+
+// RequestLogFilter 查询请求日志的条件,为空的字段不参与过滤
+type RequestLogFilter struct {
+	KeyId  string
+	Model  string
+	Limit  int
+	Offset int
+}
+
+// maxPendingRequestLogs 最多缓存的未写入请求日志数,数据库持续不可用时丢弃最早的日志
+const maxPendingRequestLogs = 10000
+
+var (
+	// pendingRequestLogs 尚未写入数据库的请求日志,由 FlushRequestLogs 定期批量写入
+	pendingRequestLogs      []RequestLog
+	pendingRequestLogsMutex sync.Mutex
+)
+
+// AddRequestLog 记录一条请求日志。日志先缓存在内存中,由 FlushRequestLogs 批量写入数据库
+func AddRequestLog(log RequestLog) {
+	if RequestLogEnable != 1 {
+		return
+	}
+	if log.CreatedAt.IsZero() {
+		log.CreatedAt = time.Now()
+	}
+
+	pendingRequestLogsMutex.Lock()
+	defer pendingRequestLogsMutex.Unlock()
+	setPendingRequestLogsLocked(append(pendingRequestLogs, log))
+}
+
+// setPendingRequestLogsLocked 替换待写入的请求日志,超出上限时丢弃最早的日志,调用方需持有 pendingRequestLogsMutex
+func setPendingRequestLogsLocked(logs []RequestLog) {
+	if overflow := len(logs) - maxPendingRequestLogs; overflow > 0 {
+		logs = append([]RequestLog(nil), logs[overflow:]...)
+	}
+	pendingRequestLogs = logs
+}
+
+// FlushRequestLogs 将内存中缓存的请求日志批量写入数据库,写入失败的日志留待下次写入
+func FlushRequestLogs() error {
+	pendingRequestLogsMutex.Lock()
+	logs := pendingRequestLogs
+	pendingRequestLogs = nil
+	pendingRequestLogsMutex.Unlock()
+
+	if len(logs) == 0 {
+		return nil
+	}
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		return tx.CreateInBatches(logs, 100).Error
+	})
+	if err != nil {
+		// 放回队列前清除失败的批量写入可能已分配的ID
+		for i := range logs {
+			logs[i].Id = 0
+		}
+		pendingRequestLogsMutex.Lock()
+		setPendingRequestLogsLocked(append(logs, pendingRequestLogs...))
+		pendingRequestLogsMutex.Unlock()
+	}
+	return err
+}
+
+// ListRequestLogs 按时间倒序查询请求日志
+func ListRequestLogs(filter RequestLogFilter) ([]RequestLog, error) {
+	query := DB.Model(&RequestLog{})
+	if filter.KeyId != "" {
+		query = query.Where("api_key = ?", filter.KeyId)
+	}
+	if filter.Model != "" {
+		query = query.Where("model = ?", filter.Model)
+	}
+	logs := []RequestLog{}
+	err := query.Order("id DESC").Limit(filter.Limit).Offset(filter.Offset).Find(&logs).Error
+	return logs, err
+}
+
+// CleanupRequestLogs 删除超过保留天数的请求日志
+func CleanupRequestLogs() (int64, error) {
+	if RequestLogRetentionDays <= 0 {
+		return 0, nil
+	}
+	result := DB.Where("created_at < ?", time.Now().AddDate(0, 0, -RequestLogRetentionDays)).Delete(&RequestLog{})
+	return result.RowsAffected, result.Error
+}
@@ -1,8 +0,0 @@
-package common
-
-var UsingSQLite = false
-var UsingPostgreSQL = false
-var UsingMySQL = false
-
-//var SQLitePath = "kilo-2-api.db"
-//var SQLiteBusyTimeout = env.Int("SQLITE_BUSY_TIMEOUT", 3000)
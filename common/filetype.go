@@ -13,6 +13,7 @@ const (
 	TXT_TYPE  = "text/plain"
 	PDF_TYPE  = "application/pdf"
 	DOC_TYPE  = "application/msword"
+	DOCX_TYPE = "application/vnd.openxmlformats-officedocument.wordprocessingml.document"
 	JPG_TYPE  = "image/jpeg"
 	PNG_TYPE  = "image/png"
 	WEBP_TYPE = "image/webp"
@@ -171,6 +172,16 @@ func DetectFileType(base64Data string) *FileTypeResult {
 		}
 	}
 
+	// DOCX为zip压缩包,包含word/目录
+	if len(data) >= 4 && bytes.HasPrefix(data, []byte{0x50, 0x4B, 0x03, 0x04}) && bytes.Contains(data, []byte("word/")) {
+		return &FileTypeResult{
+			MimeType:    DOCX_TYPE,
+			Extension:   ".docx",
+			Description: "Microsoft Word Document",
+			IsValid:     true,
+		}
+	}
+
 	// 增强的文本检测
 	if isTextFile(data) {
 		return &FileTypeResult{
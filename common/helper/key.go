@@ -2,4 +2,10 @@ package helper
 
 const (
 	RequestIdKey = "X-Request-Id"
+	ApiKeyIdKey  = "api_key_id" // 通过校验的请求API-KEY的ID,不保存完整密钥
+
+	// 对话请求实际使用的账号与token数,供请求日志记录
+	CookieKey           = "relay_cookie"
+	PromptTokensKey     = "relay_prompt_tokens"
+	CompletionTokensKey = "relay_completion_tokens"
 )
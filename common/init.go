@@ -13,6 +13,7 @@ var (
 	PrintVersion = flag.Bool("version", false, "print version and exit")
 	PrintHelp    = flag.Bool("help", false, "print help and exit")
 	LogDir       = flag.String("log-dir", "", "specify the log directory")
+	MockUpstream = flag.Bool("mock-upstream", false, "serve a local mock getbind upstream and route requests to it")
 )
 
 // UploadPath Maybe override by ENV_VAR
@@ -22,10 +23,12 @@ func printHelp() {
 	fmt.Println("getbind2api" + Version + "")
 	fmt.Println("Copyright (C) 2025 Dean. All rights reserved.")
 	fmt.Println("GitHub: https://github.com/deanxv/getbind2api ")
-	fmt.Println("Usage: getbind2api [--port <port>] [--log-dir <log directory>] [--version] [--help]")
+	fmt.Println("Usage: getbind2api [--port <port>] [--log-dir <log directory>] [--mock-upstream] [--version] [--help]")
 }
 
-func init() {
+// ParseFlags 解析命令行参数,需在 main 开头调用。
+// 不在 init 中解析,以免与 go test 的参数冲突
+func ParseFlags() {
 	flag.Parse()
 
 	if *PrintVersion {
@@ -0,0 +1,155 @@
+// Package metrics 定义服务暴露给 Prometheus 的监控指标
+package metrics
+
+import (
+	"getbind2api/common"
+	"getbind2api/common/config"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"strconv"
+	"time"
+)
+
+const namespace = "getbind2api"
+
+// 上游错误分类
+const (
+	UpstreamErrorRateLimit      = "rate_limit"
+	UpstreamErrorNotLogin       = "not_login"
+	UpstreamErrorUsageExhausted = "usage_exhausted"
+	UpstreamErrorServerError    = "server_error"
+	UpstreamErrorCloudflare     = "cloudflare"
+	UpstreamErrorForbidden      = "forbidden"
+	UpstreamErrorOther          = "other"
+)
+
+// gin.Context 中记录请求信息的key
+const (
+	startTimeKey = "metrics_start_time"
+	modelKey     = "metrics_model"
+	streamKey    = "metrics_stream"
+)
+
+var (
+	RequestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "Total number of chat requests.",
+	}, []string{"model", "stream", "status"})
+
+	RequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "Chat request latency in seconds.",
+		Buckets:   []float64{0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300},
+	}, []string{"model", "stream", "status"})
+
+	TimeToFirstToken = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "time_to_first_token_seconds",
+		Help:      "Time from receiving the request to the first upstream output in seconds.",
+		Buckets:   []float64{0.25, 0.5, 1, 2, 3, 5, 10, 20, 30, 60},
+	}, []string{"model", "stream"})
+
+	UpstreamErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upstream_errors_total",
+		Help:      "Total number of upstream errors by class.",
+	}, []string{"class"})
+
+	ActiveStreams = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_streams",
+		Help:      "Number of streaming responses in progress.",
+	})
+
+	Tokens = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "tokens_total",
+		Help:      "Total number of tokens counted by model and type (prompt/completion).",
+	}, []string{"model", "type"})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cookie_pool_size",
+		Help:      "Number of accounts in the cookie pool.",
+	}, func() float64 {
+		return float64(config.GetCookiePoolStats().Total)
+	})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cookie_pool_available",
+		Help:      "Number of accounts that are enabled and not quarantined.",
+	}, func() float64 {
+		return float64(config.GetCookiePoolStats().Available)
+	})
+
+	_ = promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "cookie_pool_locked",
+		Help:      "Number of accounts currently locked after hitting the upstream rate limit.",
+	}, func() float64 {
+		return float64(config.GetCookiePoolStats().Locked)
+	})
+)
+
+// StartRequest 记录请求开始时间
+func StartRequest(c *gin.Context) {
+	c.Set(startTimeKey, time.Now())
+}
+
+// SetRequestLabels 由各接口在解析请求后记录模型与流式模式,供中间件统计。
+// 别名记为对应的模型,不支持的模型统一记为 unsupported,避免标签数量无限增长
+func SetRequestLabels(c *gin.Context, model string, stream bool) {
+	if info, ok := common.GetModelInfo(model); ok {
+		model = info.Id
+	} else {
+		model = "unsupported"
+	}
+	c.Set(modelKey, model)
+	c.Set(streamKey, stream)
+}
+
+// ObserveRequest 在请求结束后记录请求数与耗时
+func ObserveRequest(c *gin.Context, status int) {
+	model, stream := requestLabels(c)
+	statusLabel := strconv.Itoa(status)
+	RequestsTotal.WithLabelValues(model, stream, statusLabel).Inc()
+	RequestDuration.WithLabelValues(model, stream, statusLabel).Observe(time.Since(startTime(c)).Seconds())
+}
+
+// ObserveFirstToken 记录收到上游第一段输出的耗时
+func ObserveFirstToken(c *gin.Context) {
+	model, stream := requestLabels(c)
+	TimeToFirstToken.WithLabelValues(model, stream).Observe(time.Since(startTime(c)).Seconds())
+}
+
+// AddTokens 累计 prompt 与 completion 的token数
+func AddTokens(model string, promptTokens, completionTokens int) {
+	Tokens.WithLabelValues(model, "prompt").Add(float64(promptTokens))
+	Tokens.WithLabelValues(model, "completion").Add(float64(completionTokens))
+}
+
+// RequestModel 返回 SetRequestLabels 记录的模型与流式模式
+func RequestModel(c *gin.Context) (string, bool) {
+	return c.GetString(modelKey), c.GetBool(streamKey)
+}
+
+func requestLabels(c *gin.Context) (string, string) {
+	model := c.GetString(modelKey)
+	if model == "" {
+		model = "unknown"
+	}
+	return model, strconv.FormatBool(c.GetBool(streamKey))
+}
+
+func startTime(c *gin.Context) time.Time {
+	if start, ok := c.Get(startTimeKey); ok {
+		if t, ok := start.(time.Time); ok {
+			return t
+		}
+	}
+	return time.Now()
+}
@@ -0,0 +1,210 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"getbind2api/common/env"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ModelConfigPath 模型配置文件路径(.json/.yaml/.yml),为空时使用内置模型列表
+var ModelConfigPath = env.String("MODEL_CONFIG_PATH", "")
+
+// defaultBotId 未配置 bot_id 时使用的默认值
+const defaultBotId = "661cacc79657814effd8db6c"
+
+type ModelInfo struct {
+	Id           string            `json:"-" yaml:"-"`                         // 对外的模型名,即配置中的键
+	Model        string            `json:"model" yaml:"model"`                 // 上游模型名
+	BotId        string            `json:"bot_id" yaml:"bot_id"`               // 上游 bot_id
+	MaxTokens    int               `json:"max_tokens" yaml:"max_tokens"`       // 上下文窗口大小
+	Aliases      []string          `json:"aliases,omitempty" yaml:"aliases"`   // 别名,请求时等同于 Id
+	OwnedBy      string            `json:"owned_by,omitempty" yaml:"owned_by"` // /v1/models 中的 owned_by
+	Created      int64             `json:"created,omitempty" yaml:"created"`   // /v1/models 中的 created
+	Capabilities ModelCapabilities `json:"capabilities" yaml:"capabilities"`
+}
+
+// ModelCapabilities 模型支持的能力,-thinking 结尾的模型总是支持 thinking
+type ModelCapabilities struct {
+	Vision   bool `json:"vision" yaml:"vision"`
+	Thinking bool `json:"thinking" yaml:"thinking"`
+	Tools    bool `json:"tools" yaml:"tools"`
+}
+
+// modelRegistryFile 模型配置文件格式,以对外的模型名作为键
+type modelRegistryFile struct {
+	Models map[string]ModelInfo `json:"models" yaml:"models"`
+}
+
+var (
+	modelRegistry   map[string]ModelInfo // 对外的模型名 -> 模型信息
+	modelAliases    map[string]string    // 别名 -> 对外的模型名
+	modelRegistryMu sync.RWMutex
+)
+
+func init() {
+	if err := setModelRegistry(defaultModelRegistry()); err != nil {
+		panic(err)
+	}
+}
+
+// defaultModelRegistry 内置模型列表
+func defaultModelRegistry() map[string]ModelInfo {
+	return map[string]ModelInfo{
+		"gpt-4o-mini": {
+			Model:     "gpt-4o-mini",
+			BotId:     defaultBotId,
+			MaxTokens: 128000,
+			Aliases:   []string{"gpt-4o-mini-2024-07-18"},
+			OwnedBy:   "openai",
+			Created:   1721172741,
+			Capabilities: ModelCapabilities{
+				Vision: true,
+				Tools:  true,
+			},
+		},
+		"o3-mini": {
+			Model:     "o3-mini",
+			BotId:     defaultBotId,
+			MaxTokens: 200000,
+			Aliases:   []string{"o3-mini-2025-01-31"},
+			OwnedBy:   "openai",
+			Created:   1737146383,
+			Capabilities: ModelCapabilities{
+				Tools: true,
+			},
+		},
+		"claude-3-7-sonnet": {
+			Model:     "claude-3.7-sonnet",
+			BotId:     defaultBotId,
+			MaxTokens: 200000,
+			Aliases:   []string{"claude-3-7-sonnet-latest", "claude-3-7-sonnet-20250219"},
+			OwnedBy:   "anthropic",
+			Created:   1740355200,
+			Capabilities: ModelCapabilities{
+				Vision: true,
+				Tools:  true,
+			},
+		},
+		"claude-3-7-sonnet-thinking": {
+			Model:     "claude-3.7-sonnet-et",
+			BotId:     defaultBotId,
+			MaxTokens: 200000,
+			OwnedBy:   "anthropic",
+			Created:   1740355200,
+			Capabilities: ModelCapabilities{
+				Vision:   true,
+				Thinking: true,
+				Tools:    true,
+			},
+		},
+	}
+}
+
+// LoadModelRegistry 从 MODEL_CONFIG_PATH 加载模型列表,未设置时使用内置模型列表。
+// 加载失败时保留当前的模型列表
+func LoadModelRegistry() error {
+	if ModelConfigPath == "" {
+		return setModelRegistry(defaultModelRegistry())
+	}
+
+	data, err := os.ReadFile(ModelConfigPath)
+	if err != nil {
+		return err
+	}
+	var file modelRegistryFile
+	switch strings.ToLower(filepath.Ext(ModelConfigPath)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &file)
+	default:
+		err = json.Unmarshal(data, &file)
+	}
+	if err != nil {
+		return fmt.Errorf("parse %s err: %v", ModelConfigPath, err)
+	}
+	if len(file.Models) == 0 {
+		return fmt.Errorf("no models in %s", ModelConfigPath)
+	}
+	return setModelRegistry(file.Models)
+}
+
+// setModelRegistry 校验并替换模型列表
+func setModelRegistry(models map[string]ModelInfo) error {
+	registry := make(map[string]ModelInfo, len(models))
+	aliases := map[string]string{}
+	for id, info := range models {
+		if info.Model == "" {
+			return fmt.Errorf("model %s: upstream model is required", id)
+		}
+		if info.MaxTokens <= 0 {
+			return fmt.Errorf("model %s: max_tokens must be positive", id)
+		}
+		if info.BotId == "" {
+			info.BotId = defaultBotId
+		}
+		if strings.HasSuffix(id, "-thinking") {
+			info.Capabilities.Thinking = true
+		}
+		info.Id = id
+		registry[id] = info
+	}
+	for id, info := range registry {
+		for _, alias := range info.Aliases {
+			if _, ok := registry[alias]; ok {
+				return fmt.Errorf("model %s: alias %s conflicts with a model", id, alias)
+			}
+			if other, ok := aliases[alias]; ok && other != id {
+				return fmt.Errorf("model %s: alias %s is already used by %s", id, alias, other)
+			}
+			aliases[alias] = id
+		}
+	}
+
+	modelRegistryMu.Lock()
+	defer modelRegistryMu.Unlock()
+	modelRegistry = registry
+	modelAliases = aliases
+	return nil
+}
+
+// GetModelInfo 通过模型名或别名查询模型信息,返回值的 Id 为对外的模型名
+func GetModelInfo(modelName string) (ModelInfo, bool) {
+	modelRegistryMu.RLock()
+	defer modelRegistryMu.RUnlock()
+
+	if id, ok := modelAliases[modelName]; ok {
+		modelName = id
+	}
+	info, exists := modelRegistry[modelName]
+	return info, exists
+}
+
+// GetModelList 返回按名称排序的模型列表(不含别名)
+func GetModelList() []string {
+	modelRegistryMu.RLock()
+	defer modelRegistryMu.RUnlock()
+
+	var modelList []string
+	for k := range modelRegistry {
+		modelList = append(modelList, k)
+	}
+	sort.Strings(modelList)
+	return modelList
+}
+
+// GetModelAliases 返回别名与对外的模型名的对应关系
+func GetModelAliases() map[string]string {
+	modelRegistryMu.RLock()
+	defer modelRegistryMu.RUnlock()
+
+	aliases := make(map[string]string, len(modelAliases))
+	for alias, id := range modelAliases {
+		aliases[alias] = id
+	}
+	return aliases
+}
@@ -0,0 +1,89 @@
+// Package session 缓存客户端对话与上游 session_id 的对应关系,
+// 多轮对话命中缓存时只需向上游发送新增的消息
+package session
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"getbind2api/common/config"
+	"sync"
+	"time"
+)
+
+// Entry 一次已完成对话所使用的账号与上游会话
+type Entry struct {
+	Cookie    string
+	SessionId string
+	ExpiresAt time.Time
+}
+
+var (
+	entries   = map[string]Entry{}
+	lastSweep time.Time
+	mu        sync.Mutex
+)
+
+// Enabled 是否开启会话缓存(SESSION_CACHE_TTL 大于0)
+func Enabled() bool {
+	return config.SessionCacheTTL > 0
+}
+
+func ttl() time.Duration {
+	return time.Duration(config.SessionCacheTTL) * time.Second
+}
+
+// Key 以API-KEY、模型与消息列表的哈希作为缓存键,不同API-KEY的对话不会共用上游会话
+func Key(apiKeyId, model string, messages interface{}) (string, error) {
+	messagesJSON, err := json.Marshal(messages)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(apiKeyId))
+	h.Write([]byte{0})
+	h.Write([]byte(model))
+	h.Write([]byte{0})
+	h.Write(messagesJSON)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Take 取出并删除未过期的缓存。上游会话复用后已包含新的消息,
+// 同一消息列表再次请求(如重新生成回复)时不能再复用
+func Take(key string) (Entry, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	entry, ok := entries[key]
+	if !ok {
+		return Entry{}, false
+	}
+	delete(entries, key)
+	if time.Now().After(entry.ExpiresAt) {
+		return Entry{}, false
+	}
+	return entry, true
+}
+
+// Put 记录对话使用的账号与上游会话,同时清理已过期的缓存
+func Put(key, cookie, sessionId string) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Now()
+	entries[key] = Entry{
+		Cookie:    cookie,
+		SessionId: sessionId,
+		ExpiresAt: now.Add(ttl()),
+	}
+
+	if now.Sub(lastSweep) < ttl() {
+		return
+	}
+	lastSweep = now
+	for k, entry := range entries {
+		if now.After(entry.ExpiresAt) {
+			delete(entries, k)
+		}
+	}
+}
@@ -145,7 +145,8 @@ func IsCloudflareBlock(data string) bool {
 
 func IsCloudflareChallenge(data string) bool {
 	// 检查基本的 HTML 结构
-	htmlPattern := `^<!DOCTYPE html><html.*?><head>.*?</head><body.*?>.*?</body></html>$`
+	// 页面通常为多行,需要 . 匹配换行
+	htmlPattern := `(?is)^<!DOCTYPE html>\s*<html.*?>.*?<head>.*?</head>.*?<body.*?>.*?</body>\s*</html>$`
 
 	// 检查 Cloudflare 特征
 	cfPatterns := []string{
@@ -0,0 +1,265 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"getbind2api/common"
+	"getbind2api/common/config"
+	logger "getbind2api/common/loggger"
+	"getbind2api/cycletls"
+	"getbind2api/getbind-api"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// AddCookiesRequest 添加cookie请求,user_id 支持以,分隔多个
+type AddCookiesRequest struct {
+	UserId  string   `json:"user_id"`
+	UserIds []string `json:"user_ids"`
+}
+
+// ListCookies @Summary cookie池列表
+// @Description cookie池列表
+// @Tags Backend
+// @Produce json
+// @Param Authorization header string true "Authorization BACKEND_SECRET"
+// @Success 200 {object} common.ResponseResult{data=[]config.CookieInfo} "成功"
+// @Router /api/cookies [get]
+func ListCookies(c *gin.Context) {
+	common.SendResponse(c, http.StatusOK, 0, "success", config.ListCookies())
+}
+
+// AddCookies @Summary 添加cookie
+// @Description 添加cookie
+// @Tags Backend
+// @Accept json
+// @Produce json
+// @Param req body AddCookiesRequest true "user_id"
+// @Param Authorization header string true "Authorization BACKEND_SECRET"
+// @Success 200 {object} common.ResponseResult{data=[]string} "成功"
+// @Router /api/cookies [post]
+func AddCookies(c *gin.Context) {
+	var req AddCookiesRequest
+	if err := c.BindJSON(&req); err != nil {
+		common.SendResponse(c, http.StatusBadRequest, 1, "Invalid request parameters", "")
+		return
+	}
+
+	userIds := append(strings.Split(req.UserId, ","), req.UserIds...)
+	added, err := config.AddCookies(userIds)
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "AddCookies err: %v", err)
+		common.SendResponse(c, http.StatusInternalServerError, 1, err.Error(), "")
+		return
+	}
+	common.SendResponse(c, http.StatusOK, 0, "success", added)
+}
+
+// DisableCookie @Summary 禁用cookie
+// @Description 禁用cookie,禁用后不再参与请求
+// @Tags Backend
+// @Produce json
+// @Param userId path string true "user_id"
+// @Param Authorization header string true "Authorization BACKEND_SECRET"
+// @Success 200 {object} common.ResponseResult "成功"
+// @Router /api/cookies/{userId}/disable [put]
+func DisableCookie(c *gin.Context) {
+	setCookieDisabled(c, true)
+}
+
+// EnableCookie @Summary 启用cookie
+// @Description 启用cookie,同时解除限流锁定
+// @Tags Backend
+// @Produce json
+// @Param userId path string true "user_id"
+// @Param Authorization header string true "Authorization BACKEND_SECRET"
+// @Success 200 {object} common.ResponseResult "成功"
+// @Router /api/cookies/{userId}/enable [put]
+func EnableCookie(c *gin.Context) {
+	setCookieDisabled(c, false)
+}
+
+func setCookieDisabled(c *gin.Context, disabled bool) {
+	err := config.SetCookieDisabled(c.Param("userId"), disabled)
+	if err != nil {
+		sendCookieError(c, err)
+		return
+	}
+	common.SendResponse(c, http.StatusOK, 0, "success", "")
+}
+
+// UpdateCookieRequest 更新cookie设置请求,未传的字段保持不变
+type UpdateCookieRequest struct {
+	Weight         *int    `json:"weight"`
+	MaxConcurrency *int    `json:"max_concurrency"`
+	Profile        *string `json:"profile"`
+}
+
+// UpdateCookie @Summary 更新cookie设置
+// @Description 设置cookie的权重(weighted策略)、并发上限和浏览器指纹,设置为0或空字符串时恢复默认值
+// @Tags Backend
+// @Accept json
+// @Produce json
+// @Param userId path string true "user_id"
+// @Param req body UpdateCookieRequest true "cookie设置"
+// @Param Authorization header string true "Authorization BACKEND_SECRET"
+// @Success 200 {object} common.ResponseResult "成功"
+// @Router /api/cookies/{userId} [put]
+func UpdateCookie(c *gin.Context) {
+	var req UpdateCookieRequest
+	if err := c.BindJSON(&req); err != nil {
+		common.SendResponse(c, http.StatusBadRequest, 1, "Invalid request parameters", "")
+		return
+	}
+	if (req.Weight != nil && *req.Weight < 0) || (req.MaxConcurrency != nil && *req.MaxConcurrency < 0) {
+		common.SendResponse(c, http.StatusBadRequest, 1, "weight and max_concurrency must not be negative", "")
+		return
+	}
+	if req.Profile != nil && *req.Profile != "" {
+		profile, ok := cycletls.GetProfile(*req.Profile)
+		if !ok {
+			common.SendResponse(c, http.StatusBadRequest, 1, fmt.Sprintf("unknown profile %s, available: %s", *req.Profile, strings.Join(cycletls.ProfileNames(), ", ")), "")
+			return
+		}
+		req.Profile = &profile.Name
+	}
+
+	if err := config.SetCookieSettings(c.Param("userId"), req.Weight, req.MaxConcurrency, req.Profile); err != nil {
+		sendCookieError(c, err)
+		return
+	}
+	common.SendResponse(c, http.StatusOK, 0, "success", "")
+}
+
+// DeleteCookie @Summary 删除cookie
+// @Description 删除cookie
+// @Tags Backend
+// @Produce json
+// @Param userId path string true "user_id"
+// @Param Authorization header string true "Authorization BACKEND_SECRET"
+// @Success 200 {object} common.ResponseResult "成功"
+// @Router /api/cookies/{userId} [delete]
+func DeleteCookie(c *gin.Context) {
+	if err := config.DeleteCookie(c.Param("userId")); err != nil {
+		sendCookieError(c, err)
+		return
+	}
+	common.SendResponse(c, http.StatusOK, 0, "success", "")
+}
+
+func sendCookieError(c *gin.Context, err error) {
+	if errors.Is(err, config.ErrCookieNotFound) {
+		common.SendResponse(c, http.StatusNotFound, 1, err.Error(), "")
+		return
+	}
+	logger.Errorf(c.Request.Context(), "cookie pool err: %v", err)
+	common.SendResponse(c, http.StatusInternalServerError, 1, err.Error(), "")
+}
+
+// CookieHealthResponse 账号健康状态汇总
+type CookieHealthResponse struct {
+	Total    int                 `json:"total"`
+	Statuses map[string]int      `json:"statuses"`
+	Cookies  []config.CookieInfo `json:"cookies"`
+}
+
+// CookiesHealth @Summary 账号健康状态
+// @Description 账号健康状态,invalid/usage_exhausted 状态的账号不参与请求
+// @Tags Backend
+// @Produce json
+// @Param Authorization header string true "Authorization BACKEND_SECRET"
+// @Success 200 {object} common.ResponseResult{data=CookieHealthResponse} "成功"
+// @Router /api/cookies/health [get]
+func CookiesHealth(c *gin.Context) {
+	cookies := config.ListCookies()
+	resp := CookieHealthResponse{
+		Total:    len(cookies),
+		Statuses: map[string]int{},
+		Cookies:  cookies,
+	}
+	for _, info := range cookies {
+		status := info.Status
+		if info.Disabled {
+			status = "disabled"
+		} else if status == config.CookieStatusUnknown {
+			status = "unknown"
+		}
+		resp.Statuses[status]++
+	}
+	common.SendResponse(c, http.StatusOK, 0, "success", resp)
+}
+
+// CheckCookieHealth @Summary 立即探测账号
+// @Description 通过该账号发送一条探测请求并更新健康状态
+// @Tags Backend
+// @Produce json
+// @Param userId path string true "user_id"
+// @Param Authorization header string true "Authorization BACKEND_SECRET"
+// @Success 200 {object} common.ResponseResult{data=config.CookieInfo} "成功"
+// @Router /api/cookies/{userId}/check [post]
+func CheckCookieHealth(c *gin.Context) {
+	userId := c.Param("userId")
+	if _, ok := findCookie(userId); !ok {
+		sendCookieError(c, config.ErrCookieNotFound)
+		return
+	}
+	if _, _, err := getbind_api.CheckCookieHealth(c.Request.Context(), userId); err != nil {
+		sendCookieError(c, err)
+		return
+	}
+	info, _ := findCookie(userId)
+	common.SendResponse(c, http.StatusOK, 0, "success", info)
+}
+
+func findCookie(userId string) (config.CookieInfo, bool) {
+	for _, info := range config.ListCookies() {
+		if info.UserId == userId {
+			return info, true
+		}
+	}
+	return config.CookieInfo{}, false
+}
+
+// ListRequestLogs @Summary 请求日志
+// @Description 按时间倒序查询对话请求日志
+// @Tags Backend
+// @Produce json
+// @Param key_id query string false "API-KEY的ID"
+// @Param model query string false "模型名"
+// @Param limit query int false "返回条数,默认100,最大1000"
+// @Param offset query int false "跳过条数"
+// @Param Authorization header string true "Authorization BACKEND_SECRET"
+// @Success 200 {object} common.ResponseResult{data=[]config.RequestLog} "成功"
+// @Router /api/logs [get]
+func ListRequestLogs(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+	logs, err := config.ListRequestLogs(config.RequestLogFilter{
+		KeyId:  c.Query("key_id"),
+		Model:  c.Query("model"),
+		Limit:  limit,
+		Offset: max(offset, 0),
+	})
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "ListRequestLogs err: %v", err)
+		common.SendResponse(c, http.StatusInternalServerError, 1, err.Error(), "")
+		return
+	}
+	common.SendResponse(c, http.StatusOK, 0, "success", logs)
+}
+
+// ListProxies @Summary 代理池列表
+// @Description 代理池中各代理的请求数、失败数与暂停状态
+// @Tags Backend
+// @Produce json
+// @Param Authorization header string true "Authorization BACKEND_SECRET"
+// @Success 200 {object} common.ResponseResult{data=[]config.ProxyInfo} "成功"
+// @Router /api/proxies [get]
+func ListProxies(c *gin.Context) {
+	common.SendResponse(c, http.StatusOK, 0, "success", config.ListProxies())
+}
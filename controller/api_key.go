@@ -0,0 +1,205 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"getbind2api/common"
+	"getbind2api/common/config"
+	"getbind2api/common/helper"
+	logger "getbind2api/common/loggger"
+	"getbind2api/model"
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"net/http"
+	"time"
+)
+
+// errCodeInsufficientQuota API-KEY当日token数已用尽
+const errCodeInsufficientQuota = "insufficient_quota"
+
+var errInvalidApiKeySettings = errors.New("invalid api key settings")
+
+// checkApiKeyQuota 检查当前API-KEY能否使用该模型,以及当日剩余token数是否足够发送提示词
+func checkApiKeyQuota(c *gin.Context, openAIReq *model.OpenAIChatCompletionRequest) *relayError {
+	apiKey := c.GetString(helper.ApiKeyIdKey)
+	if !config.ApiKeyAllowsModel(apiKey, openAIReq.Model) {
+		return newRelayError(http.StatusForbidden, "model_not_allowed", fmt.Sprintf("Model %s is not allowed for this API key", openAIReq.Model))
+	}
+
+	remaining := config.ApiKeyRemainingTokens(apiKey)
+	if remaining < 0 {
+		return nil
+	}
+	if promptTokens := openAIReq.CountPromptTokens(); promptTokens > remaining {
+		return newRelayError(http.StatusTooManyRequests, errCodeInsufficientQuota, fmt.Sprintf("Daily token quota exceeded: prompt is %d tokens, %d tokens remaining today", promptTokens, remaining))
+	}
+	return nil
+}
+
+// ApiKeyRequest 创建或修改API-KEY请求,修改时未传的字段保持不变
+type ApiKeyRequest struct {
+	Key         string     `json:"key"` // 仅创建时有效,为空时自动生成
+	Name        *string    `json:"name"`
+	Models      []string   `json:"models"`
+	RateLimit   *int       `json:"rate_limit"`
+	DailyTokens *int       `json:"daily_tokens"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	Disabled    *bool      `json:"disabled"`
+}
+
+// apply 将请求中传入的字段写入 info
+func (req ApiKeyRequest) apply(info *config.ApiKeyInfo) error {
+	if (req.RateLimit != nil && *req.RateLimit < 0) || (req.DailyTokens != nil && *req.DailyTokens < 0) {
+		return fmt.Errorf("%w: rate_limit and daily_tokens must not be negative", errInvalidApiKeySettings)
+	}
+	// 别名统一为对外的模型名,与请求时检查的模型名一致
+	models := make([]string, 0, len(req.Models))
+	for _, modelName := range req.Models {
+		if modelName != "*" {
+			modelInfo, ok := common.GetModelInfo(modelName)
+			if !ok {
+				return fmt.Errorf("%w: model %s not supported", errInvalidApiKeySettings, modelName)
+			}
+			modelName = modelInfo.Id
+		}
+		if !lo.Contains(models, modelName) {
+			models = append(models, modelName)
+		}
+	}
+
+	if req.Name != nil {
+		info.Name = *req.Name
+	}
+	if req.Models != nil {
+		info.Models = models
+	}
+	if req.RateLimit != nil {
+		info.RateLimit = *req.RateLimit
+	}
+	if req.DailyTokens != nil {
+		info.DailyTokens = *req.DailyTokens
+	}
+	if req.ExpiresAt != nil {
+		// 传入零值时取消过期时间
+		info.ExpiresAt = req.ExpiresAt
+		if req.ExpiresAt.IsZero() {
+			info.ExpiresAt = nil
+		}
+	}
+	if req.Disabled != nil {
+		info.Disabled = *req.Disabled
+	}
+	return nil
+}
+
+// CreatedApiKey 创建的API-KEY,完整密钥只在创建时返回
+type CreatedApiKey struct {
+	config.ApiKeyInfo
+	Key string `json:"key"`
+}
+
+// ListApiKeys @Summary API-KEY列表
+// @Description 通过管理接口创建的API-KEY列表,不返回完整密钥
+// @Tags Backend
+// @Produce json
+// @Param Authorization header string true "Authorization BACKEND_SECRET"
+// @Success 200 {object} common.ResponseResult{data=[]config.ApiKeyInfo} "成功"
+// @Router /api/keys [get]
+func ListApiKeys(c *gin.Context) {
+	common.SendResponse(c, http.StatusOK, 0, "success", config.ListApiKeys())
+}
+
+// AddApiKey @Summary 创建API-KEY
+// @Description 创建API-KEY,可限制模型、每分钟请求数、每日token数与过期时间,完整密钥只在此时返回
+// @Tags Backend
+// @Accept json
+// @Produce json
+// @Param req body ApiKeyRequest true "API-KEY设置"
+// @Param Authorization header string true "Authorization BACKEND_SECRET"
+// @Success 200 {object} common.ResponseResult{data=CreatedApiKey} "成功"
+// @Router /api/keys [post]
+func AddApiKey(c *gin.Context) {
+	var req ApiKeyRequest
+	if err := c.BindJSON(&req); err != nil {
+		common.SendResponse(c, http.StatusBadRequest, 1, "Invalid request parameters", "")
+		return
+	}
+
+	var info config.ApiKeyInfo
+	if err := req.apply(&info); err != nil {
+		sendApiKeyError(c, err)
+		return
+	}
+	info, secret, err := config.AddApiKey(info, req.Key)
+	if err != nil {
+		sendApiKeyError(c, err)
+		return
+	}
+	common.SendResponse(c, http.StatusOK, 0, "success", CreatedApiKey{ApiKeyInfo: info, Key: secret})
+}
+
+// UpdateApiKey @Summary 修改API-KEY
+// @Description 修改API-KEY的设置,未传的字段保持不变,expires_at 传入零值时取消过期时间
+// @Tags Backend
+// @Accept json
+// @Produce json
+// @Param id path string true "API-KEY的ID"
+// @Param req body ApiKeyRequest true "API-KEY设置"
+// @Param Authorization header string true "Authorization BACKEND_SECRET"
+// @Success 200 {object} common.ResponseResult{data=config.ApiKeyInfo} "成功"
+// @Router /api/keys/{id} [put]
+func UpdateApiKey(c *gin.Context) {
+	var req ApiKeyRequest
+	if err := c.BindJSON(&req); err != nil {
+		common.SendResponse(c, http.StatusBadRequest, 1, "Invalid request parameters", "")
+		return
+	}
+
+	info, err := config.UpdateApiKey(c.Param("id"), req.apply)
+	if err != nil {
+		sendApiKeyError(c, err)
+		return
+	}
+	common.SendResponse(c, http.StatusOK, 0, "success", info)
+}
+
+// DeleteApiKey @Summary 删除API-KEY
+// @Description 删除API-KEY及其用量记录
+// @Tags Backend
+// @Produce json
+// @Param id path string true "API-KEY的ID"
+// @Param Authorization header string true "Authorization BACKEND_SECRET"
+// @Success 200 {object} common.ResponseResult "成功"
+// @Router /api/keys/{id} [delete]
+func DeleteApiKey(c *gin.Context) {
+	if err := config.DeleteApiKey(c.Param("id")); err != nil {
+		sendApiKeyError(c, err)
+		return
+	}
+	common.SendResponse(c, http.StatusOK, 0, "success", "")
+}
+
+// ApiKeysUsage @Summary API-KEY用量
+// @Description 各API-KEY当日及累计的请求数与token数,包括环境变量 API_SECRET 中的API-KEY
+// @Tags Backend
+// @Produce json
+// @Param Authorization header string true "Authorization BACKEND_SECRET"
+// @Success 200 {object} common.ResponseResult{data=[]config.ApiKeyUsage} "成功"
+// @Router /api/keys/usage [get]
+func ApiKeysUsage(c *gin.Context) {
+	common.SendResponse(c, http.StatusOK, 0, "success", config.ListApiKeyUsage())
+}
+
+func sendApiKeyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, config.ErrApiKeyNotFound):
+		common.SendResponse(c, http.StatusNotFound, 1, err.Error(), "")
+	case errors.Is(err, config.ErrApiKeyExists):
+		common.SendResponse(c, http.StatusConflict, 1, err.Error(), "")
+	case errors.Is(err, errInvalidApiKeySettings):
+		common.SendResponse(c, http.StatusBadRequest, 1, err.Error(), "")
+	default:
+		logger.Errorf(c.Request.Context(), "api key store err: %v", err)
+		common.SendResponse(c, http.StatusInternalServerError, 1, err.Error(), "")
+	}
+}
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"getbind2api/common/config"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestApiKeyModelAliases(t *testing.T) {
+	req := ApiKeyRequest{Models: []string{"claude-3-7-sonnet-latest", "claude-3-7-sonnet", "gpt-4o-mini-2024-07-18"}}
+	var info config.ApiKeyInfo
+	if err := req.apply(&info); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if want := []string{"claude-3-7-sonnet", "gpt-4o-mini"}; !reflect.DeepEqual(info.Models, want) {
+		t.Fatalf("models = %v, want %v", info.Models, want)
+	}
+
+	_, secret, err := config.AddApiKey(info, "")
+	if err != nil {
+		t.Fatalf("AddApiKey: %v", err)
+	}
+	t.Cleanup(func() { _ = config.DeleteApiKey(config.ApiKeyId(secret)) })
+
+	newMockUpstream(t)
+	baseUrl := newTestServer(t)
+	useCookies(t, newCookie("plain"))
+
+	tests := []struct {
+		model      string
+		wantStatus int
+	}{
+		{"claude-3-7-sonnet-20250219", http.StatusOK},
+		{"gpt-4o-mini", http.StatusOK},
+		{"o3-mini", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			status, body := doChat(t, baseUrl, chatRequest{
+				endpoint: openAIEndpoint,
+				model:    tt.model,
+				apiKey:   secret,
+				messages: []testMessage{{Role: "user", Content: "hi"}},
+			})
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body: %s", status, tt.wantStatus, body)
+			}
+		})
+	}
+}
@@ -5,15 +5,17 @@ import (
 	"fmt"
 	"getbind2api/common"
 	"getbind2api/common/config"
+	"getbind2api/common/helper"
 	logger "getbind2api/common/loggger"
+	"getbind2api/common/metrics"
 	"getbind2api/cycletls"
 	"getbind2api/getbind-api"
 	"getbind2api/model"
 	"github.com/gin-gonic/gin"
-	"github.com/samber/lo"
 	"io"
 	"math/rand"
 	"net/http"
+	"strings"
 	"time"
 )
 
@@ -36,7 +38,7 @@ func ChatForOpenAI(c *gin.Context) {
 
 	var openAIReq model.OpenAIChatCompletionRequest
 	if err := c.BindJSON(&openAIReq); err != nil {
-		logger.Errorf(c.Request.Context(), err.Error())
+		logger.Errorf(c.Request.Context(), "%s", err.Error())
 		c.JSON(http.StatusInternalServerError, model.OpenAIErrorResponse{
 			OpenAIError: model.OpenAIError{
 				Message: "Invalid request parameters",
@@ -49,6 +51,8 @@ func ChatForOpenAI(c *gin.Context) {
 
 	openAIReq.RemoveEmptyContentMessages()
 
+	metrics.SetRequestLabels(c, openAIReq.Model, openAIReq.Stream)
+
 	modelInfo, b := common.GetModelInfo(openAIReq.Model)
 	if !b {
 		c.JSON(http.StatusBadRequest, model.OpenAIErrorResponse{
@@ -60,6 +64,12 @@ func ChatForOpenAI(c *gin.Context) {
 		})
 		return
 	}
+	// 别名统一为对外的模型名
+	openAIReq.Model = modelInfo.Id
+	if relayErr := checkApiKeyQuota(c, &openAIReq); relayErr != nil {
+		sendOpenAIRelayError(c, relayErr)
+		return
+	}
 	if openAIReq.MaxTokens > modelInfo.MaxTokens {
 		c.JSON(http.StatusBadRequest, model.OpenAIErrorResponse{
 			OpenAIError: model.OpenAIError{
@@ -79,140 +89,110 @@ func ChatForOpenAI(c *gin.Context) {
 }
 
 func handleNonStreamRequest(c *gin.Context, client cycletls.CycleTLS, openAIReq model.OpenAIChatCompletionRequest, modelInfo common.ModelInfo) {
-	ctx := c.Request.Context()
-	cookieManager := config.NewCookieManager()
-	maxRetries := len(cookieManager.Cookies)
-	cookie, err := cookieManager.GetRandomCookie()
-	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
+	var assistantMsgContent string
+	var reasoningContent string
+	var promptTokens int
+	completed := false
+	thinkParser := newThinkParser(modelInfo)
+
+	relayErr := relayChat(c, client, &openAIReq, modelInfo, func(data string, requestTokens int) bool {
+		reasoning, delta, shouldContinue := processNoStreamData(c, data, modelInfo, thinkParser)
+		reasoningContent = reasoningContent + reasoning
+		assistantMsgContent = assistantMsgContent + delta
+		// 处理事件流数据
+		if !shouldContinue {
+			promptTokens = requestTokens
+			completed = true
+			return false
+		}
+		return true
+	})
+	if relayErr.isClientCancelled() {
+		c.Status(relayErr.StatusCode)
+		return
+	}
+	if relayErr != nil {
+		sendOpenAIRelayError(c, relayErr)
+		return
+	}
+	if !completed {
 		return
 	}
-	for attempt := 0; attempt < maxRetries; attempt++ {
-		requestBody, err := createRequestBody(c, &openAIReq, modelInfo, cookie)
-		if err != nil {
-			c.JSON(500, gin.H{"error": err.Error()})
-			return
-		}
-
-		jsonData, err := json.Marshal(requestBody)
-		if err != nil {
-			c.JSON(500, gin.H{"error": "Failed to marshal request body"})
-			return
-		}
-		sseChan, err := getbind_api.MakeStreamChatRequest(c, client, requestBody, cookie, modelInfo)
-		if err != nil {
-			logger.Errorf(ctx, "MakeStreamChatRequest err on attempt %d: %v", attempt+1, err)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-
-		isRateLimit := false
-		var delta string
-		var assistantMsgContent string
-		var shouldContinue bool
-		thinkStartType := new(bool)
-		thinkEndType := new(bool)
-	SSELoop:
-		for response := range sseChan {
-			data := response.Data
-			if data == "" {
-				continue
-			}
-			if response.Done && response.Data != "[DONE]" {
-				switch {
-				case common.IsServerError(data):
-					logger.Errorf(ctx, errServerErrMsg)
-					c.JSON(http.StatusInternalServerError, gin.H{"error": errServerErrMsg})
-					return
-				case common.IsNotLogin(data):
-					isRateLimit = true
-					logger.Warnf(ctx, "Cookie Not Login, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
-					break SSELoop
-				case common.IsRateLimit(data):
-					isRateLimit = true
-					logger.Warnf(ctx, "Cookie rate limited, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
-					config.AddRateLimitCookie(cookie, time.Now().Add(time.Duration(config.RateLimitCookieLockDuration)*time.Second))
-					break SSELoop
-				}
-				logger.Warnf(ctx, response.Data)
-				return
-			}
-
-			logger.Debug(ctx, data)
 
-			streamDelta, streamShouldContinue := processNoStreamData(c, data, modelInfo, thinkStartType, thinkEndType)
-			delta = streamDelta
-			shouldContinue = streamShouldContinue
-			// 处理事件流数据
-			if !shouldContinue {
-				promptTokens := model.CountTokenText(string(jsonData), openAIReq.Model)
-				completionTokens := model.CountTokenText(assistantMsgContent, openAIReq.Model)
-				finishReason := "stop"
-
-				c.JSON(http.StatusOK, model.OpenAIChatCompletionResponse{
-					ID:      fmt.Sprintf(responseIDFormat, time.Now().Format("20060102150405")),
-					Object:  "chat.completion",
-					Created: time.Now().Unix(),
-					Model:   openAIReq.Model,
-					Choices: []model.OpenAIChoice{{
-						Message: model.OpenAIMessage{
-							Role:    "assistant",
-							Content: assistantMsgContent,
-						},
-						FinishReason: &finishReason,
-					}},
-					Usage: model.OpenAIUsage{
-						PromptTokens:     promptTokens,
-						CompletionTokens: completionTokens,
-						TotalTokens:      promptTokens + completionTokens,
-					},
-				})
-
-				return
-			} else {
-				assistantMsgContent = assistantMsgContent + delta
-			}
-		}
-		if !isRateLimit {
-			return
-		}
+	completionTokens := model.CountTokenText(reasoningContent+assistantMsgContent, openAIReq.Model)
+	finishReason := "stop"
 
-		// 获取下一个可用的cookie继续尝试
-		cookie, err = cookieManager.GetNextCookie()
-		if err != nil {
-			logger.Errorf(ctx, "No more valid cookies available after attempt %d", attempt+1)
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+	message := model.OpenAIMessage{
+		Role:    "assistant",
+		Content: assistantMsgContent,
+	}
+	if config.ReasoningHide != 1 {
+		message.ReasoningContent = reasoningContent
+	}
+	if openAIReq.NeedToolPrompt() {
+		content, toolCalls := model.ParseToolCalls(assistantMsgContent)
+		if len(toolCalls) > 0 {
+			message.Content = content
+			message.ToolCalls = toolCalls
+			finishReason = "tool_calls"
 		}
-
 	}
-	logger.Errorf(ctx, "All cookies exhausted after %d attempts", maxRetries)
-	c.JSON(http.StatusInternalServerError, gin.H{"error": "All cookies are temporarily unavailable."})
-	return
-}
 
-func createRequestBody(c *gin.Context, openAIReq *model.OpenAIChatCompletionRequest, modelInfo common.ModelInfo, cookie string) (map[string]interface{}, error) {
-
-	client := cycletls.Init()
-	defer safeClose(client)
+	c.JSON(http.StatusOK, model.OpenAIChatCompletionResponse{
+		ID:      fmt.Sprintf(responseIDFormat, time.Now().Format("20060102150405")),
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   openAIReq.Model,
+		Choices: []model.OpenAIChoice{{
+			Message:      message,
+			FinishReason: &finishReason,
+		}},
+		Usage: &model.OpenAIUsage{
+			PromptTokens:     promptTokens,
+			CompletionTokens: completionTokens,
+			TotalTokens:      promptTokens + completionTokens,
+		},
+	})
+}
 
+// prepareRequest 补充前置消息与默认参数,每个请求只需调用一次
+func prepareRequest(openAIReq *model.OpenAIChatCompletionRequest) error {
 	if config.PRE_MESSAGES_JSON != "" {
 		err := openAIReq.PrependMessagesFromJSON(config.PRE_MESSAGES_JSON)
 		if err != nil {
-			return nil, fmt.Errorf("PrependMessagesFromJSON err: %v JSON:%s", err, config.PRE_MESSAGES_JSON)
+			return fmt.Errorf("PrependMessagesFromJSON err: %v JSON:%s", err, config.PRE_MESSAGES_JSON)
 		}
 	}
 
 	if openAIReq.MaxTokens <= 1 {
 		openAIReq.MaxTokens = 8000
 	}
+	return nil
+}
 
-	// TODO implementation
+func createRequestBody(c *gin.Context, client cycletls.CycleTLS, openAIReq *model.OpenAIChatCompletionRequest, modelInfo common.ModelInfo, cookie string, routes *getbind_api.Routes, files *fileCache, upstreamSess *upstreamSession) (map[string]interface{}, error) {
 	// 1. Generate a random session_id similar to the format in curl
 	sessionID := generateRandomSessionID(10) // Generate a 10-character random string
 
 	// 2. Format messages as JSON for the query parameter
-	messagesJSON, err := json.Marshal(openAIReq.Messages)
+	messages, err := openAIReq.BuildToolMessages()
+	if err != nil {
+		return nil, err
+	}
+
+	// Reuse the upstream session of a previous exchange and send only the new turn
+	if upstreamSess.reusableWith(cookie) && upstreamSess.NewMessages <= len(messages) {
+		sessionID = upstreamSess.SessionId
+		messages = messages[len(messages)-upstreamSess.NewMessages:]
+		logger.Debug(c.Request.Context(), fmt.Sprintf("Reuse session %s, sending %d new messages", sessionID, len(messages)))
+	}
+
+	// 3. Upload images to the upstream and reference them in the files field
+	messages, filesJSON, err := uploadMessageFiles(c.Request.Context(), client, cookie, routes, files, messages)
+	if err != nil {
+		return nil, err
+	}
+	messagesJSON, err := json.Marshal(messages)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal messages: %v", err)
 	}
@@ -223,8 +203,8 @@ func createRequestBody(c *gin.Context, openAIReq *model.OpenAIChatCompletionRequ
 		"query":      string(messagesJSON), // Put messages in JSON format in the query field
 		"bot_id":     modelInfo.BotId,      // Using the bot_id from the curl example
 		"session_id": sessionID,
-		"user_id":    cookie, // Using the user_id from the curl example
-		"files":      "{}",   // Empty files object as shown in the curl example
+		"user_id":    cookie,    // Using the user_id from the curl example
+		"files":      filesJSON, // Uploaded files keyed by file_id
 	}
 
 	// Convert form data to JSON
@@ -260,9 +240,7 @@ func generateRandomSessionID(length int) string {
 }
 
 // createStreamResponse 创建流式响应
-func createStreamResponse(responseId, modelName string, jsonData []byte, delta model.OpenAIDelta, finishReason *string) model.OpenAIChatCompletionResponse {
-	promptTokens := model.CountTokenText(string(jsonData), modelName)
-	completionTokens := model.CountTokenText(delta.Content, modelName)
+func createStreamResponse(responseId, modelName string, delta model.OpenAIDelta, finishReason *string) model.OpenAIChatCompletionResponse {
 	return model.OpenAIChatCompletionResponse{
 		ID:      responseId,
 		Object:  "chat.completion.chunk",
@@ -275,22 +253,16 @@ func createStreamResponse(responseId, modelName string, jsonData []byte, delta m
 				FinishReason: finishReason,
 			},
 		},
-		Usage: model.OpenAIUsage{
-			PromptTokens:     promptTokens,
-			CompletionTokens: completionTokens,
-			TotalTokens:      promptTokens + completionTokens,
-		},
 	}
 }
 
 // handleDelta 处理消息字段增量
-func handleDelta(c *gin.Context, delta string, responseId, modelName string, jsonData []byte) error {
+func handleDelta(c *gin.Context, delta string, responseId, modelName string) error {
 	// 创建基础响应
 	createResponse := func(content string) model.OpenAIChatCompletionResponse {
 		return createStreamResponse(
 			responseId,
 			modelName,
-			jsonData,
 			model.OpenAIDelta{Content: content, Role: "assistant"},
 			nil,
 		)
@@ -305,25 +277,49 @@ func handleDelta(c *gin.Context, delta string, responseId, modelName string, jso
 	return err
 }
 
-// handleMessageResult 处理消息结果
-func handleMessageResult(c *gin.Context, responseId, modelName string, jsonData []byte) bool {
-	finishReason := "stop"
-	var delta string
-
-	promptTokens := 0
-	completionTokens := 0
+// handleReasoningDelta 处理思考内容增量
+func handleReasoningDelta(c *gin.Context, reasoning string, responseId, modelName string) error {
+	return sendSSEvent(c, createStreamResponse(
+		responseId,
+		modelName,
+		model.OpenAIDelta{ReasoningContent: reasoning, Role: "assistant"},
+		nil,
+	))
+}
 
-	streamResp := createStreamResponse(responseId, modelName, jsonData, model.OpenAIDelta{Content: delta, Role: "assistant"}, &finishReason)
-	streamResp.Usage = model.OpenAIUsage{
-		PromptTokens:     promptTokens,
-		CompletionTokens: completionTokens,
-		TotalTokens:      promptTokens + completionTokens,
+// handleToolCallsDelta 以流式delta发送工具调用
+func handleToolCallsDelta(c *gin.Context, toolCalls []model.OpenAIToolCall, responseId, modelName string) error {
+	for i := range toolCalls {
+		index := i
+		toolCalls[i].Index = &index
 	}
+	return sendSSEvent(c, createStreamResponse(
+		responseId,
+		modelName,
+		model.OpenAIDelta{Role: "assistant", ToolCalls: toolCalls},
+		nil,
+	))
+}
+
+// handleMessageResult 处理消息结果,usage 不为空时在 [DONE] 前单独发送一个用量数据块
+func handleMessageResult(c *gin.Context, responseId, modelName string, finishReason string, usage *model.OpenAIUsage) bool {
+	var delta string
 
+	streamResp := createStreamResponse(responseId, modelName, model.OpenAIDelta{Content: delta, Role: "assistant"}, &finishReason)
 	if err := sendSSEvent(c, streamResp); err != nil {
 		logger.Warnf(c.Request.Context(), "sendSSEvent err: %v", err)
 		return false
 	}
+
+	if usage != nil {
+		usageResp := createStreamResponse(responseId, modelName, model.OpenAIDelta{}, nil)
+		usageResp.Choices = []model.OpenAIChoice{}
+		usageResp.Usage = usage
+		if err := sendSSEvent(c, usageResp); err != nil {
+			logger.Warnf(c.Request.Context(), "sendSSEvent err: %v", err)
+			return false
+		}
+	}
 	c.SSEvent("", " [DONE]")
 	return false
 }
@@ -347,115 +343,83 @@ func handleStreamRequest(c *gin.Context, client cycletls.CycleTLS, openAIReq mod
 	c.Header("Connection", "keep-alive")
 
 	responseId := fmt.Sprintf(responseIDFormat, time.Now().Format("20060102150405"))
-	ctx := c.Request.Context()
 
-	cookieManager := config.NewCookieManager()
-	maxRetries := len(cookieManager.Cookies)
-	cookie, err := cookieManager.GetRandomCookie()
-	if err != nil {
-		c.JSON(500, gin.H{"error": err.Error()})
-		return
+	thinkParser := newThinkParser(modelInfo)
+
+	var toolParser *model.ToolCallStreamParser
+	if openAIReq.NeedToolPrompt() {
+		toolParser = &model.ToolCallStreamParser{}
 	}
 
-	thinkStartType := new(bool)
-	thinkEndType := new(bool)
+	// 累计输出内容,用于 stream_options.include_usage 的用量统计
+	var completion strings.Builder
 
 	c.Stream(func(w io.Writer) bool {
-		for attempt := 0; attempt < maxRetries; attempt++ {
-			requestBody, err := createRequestBody(c, &openAIReq, modelInfo, cookie)
-			if err != nil {
-				c.JSON(500, gin.H{"error": err.Error()})
-				return false
-			}
-
-			jsonData, err := json.Marshal(requestBody)
-			if err != nil {
-				c.JSON(500, gin.H{"error": "Failed to marshal request body"})
-				return false
-			}
-			sseChan, err := getbind_api.MakeStreamChatRequest(c, client, requestBody, cookie, modelInfo)
-			if err != nil {
-				logger.Errorf(ctx, "MakeStreamChatRequest err on attempt %d: %v", attempt+1, err)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return false
-			}
-
-			isRateLimit := false
-		SSELoop:
-			for response := range sseChan {
-
-				if response.Status == 403 {
-					c.JSON(http.StatusInternalServerError, gin.H{"error": "Forbidden"})
-					return false
-				}
-
-				data := response.Data
-				if data == "" {
-					continue
-				}
-
-				if response.Done {
-					switch {
-					case common.IsServerError(data):
-						logger.Errorf(ctx, errServerErrMsg)
-						c.JSON(http.StatusInternalServerError, gin.H{"error": errServerErrMsg})
-						return false
-					case common.IsNotLogin(data):
-						isRateLimit = true
-						logger.Warnf(ctx, "Cookie Not Login, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
-						break SSELoop // 使用 label 跳出 SSE 循环
-					case common.IsRateLimit(data):
-						isRateLimit = true
-						logger.Warnf(ctx, "Cookie rate limited, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
-						config.AddRateLimitCookie(cookie, time.Now().Add(time.Duration(config.RateLimitCookieLockDuration)*time.Second))
-						break SSELoop
-					}
-					logger.Warnf(ctx, response.Data)
-					return false
-				}
-
-				logger.Debug(ctx, data)
-
-				_, shouldContinue := processStreamData(c, data, responseId, openAIReq.Model, modelInfo, jsonData, thinkStartType, thinkEndType)
-				// 处理事件流数据
-
-				if !shouldContinue {
-					return false
+		relayErr := relayChat(c, client, &openAIReq, modelInfo, func(data string, promptTokens int) bool {
+			var usage *model.OpenAIUsage
+			if data != "[DONE]" {
+				completion.WriteString(data)
+			} else if openAIReq.IncludeUsage() {
+				completionTokens := model.CountTokenText(completion.String(), openAIReq.Model)
+				usage = &model.OpenAIUsage{
+					PromptTokens:     promptTokens,
+					CompletionTokens: completionTokens,
+					TotalTokens:      promptTokens + completionTokens,
 				}
 			}
 
-			if !isRateLimit {
-				return true
-			}
-
-			// 获取下一个可用的cookie继续尝试
-			cookie, err = cookieManager.GetNextCookie()
-			if err != nil {
-				logger.Errorf(ctx, "No more valid cookies available after attempt %d", attempt+1)
-				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-				return false
-			}
+			// 处理事件流数据
+			_, shouldContinue := processStreamData(c, data, responseId, openAIReq.Model, modelInfo, usage, thinkParser, toolParser)
+			return shouldContinue
+		})
+		if relayErr.isClientCancelled() {
+			c.Status(relayErr.StatusCode)
+			return false
+		}
+		if relayErr != nil {
+			sendOpenAIRelayError(c, relayErr)
 		}
-
-		logger.Errorf(ctx, "All cookies exhausted after %d attempts", maxRetries)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "All cookies are temporarily unavailable."})
 		return false
 	})
 }
 
 // 处理流式数据的辅助函数，返回bool表示是否继续处理
-func processStreamData(c *gin.Context, data, responseId, model string, modelInfo common.ModelInfo, jsonData []byte, thinkStartType, thinkEndType *bool) (string, bool) {
+func processStreamData(c *gin.Context, data, responseId, modelName string, modelInfo common.ModelInfo, usage *model.OpenAIUsage, thinkParser *thinkParser, toolParser *model.ToolCallStreamParser) (string, bool) {
 	//data = strings.TrimSpace(data)
 	//data = strings.TrimPrefix(data, "data: ")
 
 	// 处理[DONE]标记
 	if data == "[DONE]" {
-		return "", false
+		reasoning, content := flushThink(thinkParser)
+		if err := handleStreamText(c, reasoning, content, responseId, modelName, toolParser); err != nil {
+			logger.Errorf(c.Request.Context(), "handleStreamText err: %v", err)
+			return "", false
+		}
+
+		finishReason := "stop"
+		if toolParser != nil {
+			content, toolCalls := toolParser.Finish()
+			if content != "" {
+				if err := handleDelta(c, content, responseId, modelName); err != nil {
+					logger.Errorf(c.Request.Context(), "handleDelta err: %v", err)
+					return "", false
+				}
+			}
+			if len(toolCalls) > 0 {
+				if err := handleToolCallsDelta(c, toolCalls, responseId, modelName); err != nil {
+					logger.Errorf(c.Request.Context(), "handleToolCallsDelta err: %v", err)
+					return "", false
+				}
+				finishReason = "tool_calls"
+			}
+		}
+		return "", handleMessageResult(c, responseId, modelName, finishReason, usage)
 	}
 
-	// 处理文本内容
-	if err := handleDelta(c, data, responseId, model, jsonData); err != nil {
-		logger.Errorf(c.Request.Context(), "handleDelta err: %v", err)
+	// 分离思考内容与正文
+	reasoning, content := splitThink(thinkParser, data)
+	if err := handleStreamText(c, reasoning, content, responseId, modelName, toolParser); err != nil {
+		logger.Errorf(c.Request.Context(), "handleStreamText err: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return "", false
 	}
@@ -464,45 +428,117 @@ func processStreamData(c *gin.Context, data, responseId, model string, modelInfo
 
 }
 
-func processNoStreamData(c *gin.Context, data string, modelInfo common.ModelInfo, thinkStartType *bool, thinkEndType *bool) (string, bool) {
+// handleStreamText 发送思考内容与正文,正文中的工具调用块交由 toolParser 缓存
+func handleStreamText(c *gin.Context, reasoning, content, responseId, modelName string, toolParser *model.ToolCallStreamParser) error {
+	if reasoning != "" && config.ReasoningHide != 1 {
+		if err := handleReasoningDelta(c, reasoning, responseId, modelName); err != nil {
+			return err
+		}
+	}
+
+	if toolParser != nil {
+		content = toolParser.Feed(content)
+	}
+	if content == "" {
+		return nil
+	}
+	return handleDelta(c, content, responseId, modelName)
+}
+
+func processNoStreamData(c *gin.Context, data string, modelInfo common.ModelInfo, thinkParser *thinkParser) (string, string, bool) {
 	//data = strings.TrimSpace(data)
 	//data = strings.TrimPrefix(data, "data: ")
 
 	// 处理[DONE]标记
 	if data == "[DONE]" {
-		return "", false
+		reasoning, content := flushThink(thinkParser)
+		return reasoning, content, false
 	}
 
-	return data, true
+	reasoning, content := splitThink(thinkParser, data)
+	return reasoning, content, true
 
 }
 
 // OpenaiModels @Summary OpenAI模型列表接口
-// @Description OpenAI模型列表接口
+// @Description OpenAI模型列表接口,按模型名排序,只返回当前API-KEY可使用的模型
 // @Tags OpenAI
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "Authorization API-KEY"
-// @Success 200 {object} common.ResponseResult{data=model.OpenaiModelListResponse} "成功"
+// @Success 200 {object} model.OpenaiModelListResponse "成功"
 // @Router /v1/models [get]
 func OpenaiModels(c *gin.Context) {
-	var modelsResp []string
-
-	modelsResp = lo.Union(common.GetModelList())
+	apiKey := c.GetString(helper.ApiKeyIdKey)
 
-	var openaiModelListResponse model.OpenaiModelListResponse
-	var openaiModelResponse []model.OpenaiModelResponse
-	openaiModelListResponse.Object = "list"
+	openaiModelListResponse := model.OpenaiModelListResponse{
+		Object: "list",
+		Data:   []model.OpenaiModelResponse{},
+	}
+	for _, modelName := range common.GetModelList() {
+		if !config.ApiKeyAllowsModel(apiKey, modelName) {
+			continue
+		}
+		modelInfo, ok := common.GetModelInfo(modelName)
+		if !ok {
+			continue
+		}
+		openaiModelListResponse.Data = append(openaiModelListResponse.Data, newModelResponse(modelInfo))
+	}
+	c.JSON(http.StatusOK, openaiModelListResponse)
+}
 
-	for _, modelResp := range modelsResp {
-		openaiModelResponse = append(openaiModelResponse, model.OpenaiModelResponse{
-			ID:     modelResp,
-			Object: "model",
+// OpenaiModel @Summary OpenAI模型详情接口
+// @Description OpenAI模型详情接口,支持通过别名查询
+// @Tags OpenAI
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Authorization API-KEY"
+// @Param id path string true "模型名"
+// @Success 200 {object} model.OpenaiModelResponse "成功"
+// @Router /v1/models/{id} [get]
+func OpenaiModel(c *gin.Context) {
+	modelName := c.Param("id")
+	modelInfo, ok := common.GetModelInfo(modelName)
+	if !ok || !config.ApiKeyAllowsModel(c.GetString(helper.ApiKeyIdKey), modelInfo.Id) {
+		c.JSON(http.StatusNotFound, model.OpenAIErrorResponse{
+			OpenAIError: model.OpenAIError{
+				Message: fmt.Sprintf("The model %s does not exist or you do not have access to it.", modelName),
+				Type:    "invalid_request_error",
+				Code:    "model_not_found",
+			},
 		})
+		return
 	}
-	openaiModelListResponse.Data = openaiModelResponse
-	c.JSON(http.StatusOK, openaiModelListResponse)
-	return
+	c.JSON(http.StatusOK, newModelResponse(modelInfo))
+}
+
+// newModelResponse 生成模型对象。图片需上传至上游,未开启 FILE_UPLOAD_ENABLE 时不返回 vision 能力
+func newModelResponse(modelInfo common.ModelInfo) model.OpenaiModelResponse {
+	resp := model.NewOpenaiModelResponse(modelInfo)
+	resp.Capabilities.Vision = resp.Capabilities.Vision && config.FileUploadEnable
+	return resp
+}
+
+// sendOpenAIRelayError 返回上游请求失败的原因,请求参数错误时使用OpenAI错误格式
+func sendOpenAIRelayError(c *gin.Context, relayErr *relayError) {
+	errType := "invalid_request_error"
+	switch {
+	case relayErr.Code == errCodeInsufficientQuota:
+		errType = errCodeInsufficientQuota
+	case relayErr.Code == errCodeUpstreamBlocked:
+		errType = "upstream_error"
+	case relayErr.StatusCode != http.StatusBadRequest && relayErr.StatusCode != http.StatusForbidden:
+		c.JSON(relayErr.StatusCode, gin.H{"error": relayErr.Message})
+		return
+	}
+	c.JSON(relayErr.StatusCode, model.OpenAIErrorResponse{
+		OpenAIError: model.OpenAIError{
+			Message: relayErr.Message,
+			Type:    errType,
+			Code:    relayErr.Code,
+		},
+	})
 }
 
 func safeClose(client cycletls.CycleTLS) {
@@ -513,68 +549,3 @@ func safeClose(client cycletls.CycleTLS) {
 		close(client.RespChan)
 	}
 }
-
-//
-//func processUrl(c *gin.Context, client cycletls.CycleTLS, chatId, cookie string, url string) (string, error) {
-//	// 判断是否为URL
-//	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
-//		// 下载文件
-//		bytes, err := fetchImageBytes(url)
-//		if err != nil {
-//			logger.Errorf(c.Request.Context(), fmt.Sprintf("fetchImageBytes err  %v\n", err))
-//			return "", fmt.Errorf("fetchImageBytes err  %v\n", err)
-//		}
-//
-//		base64Str := base64.StdEncoding.EncodeToString(bytes)
-//
-//		finalUrl, err := processBytes(c, client, chatId, cookie, base64Str)
-//		if err != nil {
-//			logger.Errorf(c.Request.Context(), fmt.Sprintf("processBytes err  %v\n", err))
-//			return "", fmt.Errorf("processBytes err  %v\n", err)
-//		}
-//		return finalUrl, nil
-//	} else {
-//		finalUrl, err := processBytes(c, client, chatId, cookie, url)
-//		if err != nil {
-//			logger.Errorf(c.Request.Context(), fmt.Sprintf("processBytes err  %v\n", err))
-//			return "", fmt.Errorf("processBytes err  %v\n", err)
-//		}
-//		return finalUrl, nil
-//	}
-//}
-//
-//func fetchImageBytes(url string) ([]byte, error) {
-//	resp, err := http.Get(url)
-//	if err != nil {
-//		return nil, fmt.Errorf("http.Get err: %v\n", err)
-//	}
-//	defer resp.Body.Close()
-//
-//	return io.ReadAll(resp.Body)
-//}
-//
-//func processBytes(c *gin.Context, client cycletls.CycleTLS, chatId, cookie string, base64Str string) (string, error) {
-//	// 检查类型
-//	fileType := common.DetectFileType(base64Str)
-//	if !fileType.IsValid {
-//		return "", fmt.Errorf("invalid file type %s", fileType.Extension)
-//	}
-//	signUrl, err := getbind-api.GetSignURL(client, cookie, chatId, fileType.Extension)
-//	if err != nil {
-//		logger.Errorf(c.Request.Context(), fmt.Sprintf("GetSignURL err  %v\n", err))
-//		return "", fmt.Errorf("GetSignURL err: %v\n", err)
-//	}
-//
-//	err = getbind-api.UploadToS3(client, signUrl, base64Str, fileType.MimeType)
-//	if err != nil {
-//		logger.Errorf(c.Request.Context(), fmt.Sprintf("UploadToS3 err  %v\n", err))
-//		return "", err
-//	}
-//
-//	u, err := url.Parse(signUrl)
-//	if err != nil {
-//		return "", err
-//	}
-//
-//	return fmt.Sprintf("%s://%s%s", u.Scheme, u.Host, u.Path), nil
-//}
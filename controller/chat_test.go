@@ -0,0 +1,25 @@
+package controller
+
+import (
+	"getbind2api/common"
+	"getbind2api/common/config"
+	"testing"
+)
+
+func TestModelVisionRequiresFileUpload(t *testing.T) {
+	modelInfo, ok := common.GetModelInfo("claude-3-7-sonnet")
+	if !ok || !modelInfo.Capabilities.Vision {
+		t.Fatalf("builtin model should declare vision: %+v", modelInfo)
+	}
+	saved := config.FileUploadEnable
+	t.Cleanup(func() { config.FileUploadEnable = saved })
+
+	config.FileUploadEnable = false
+	if newModelResponse(modelInfo).Capabilities.Vision {
+		t.Error("vision reported while file upload is disabled")
+	}
+	config.FileUploadEnable = true
+	if !newModelResponse(modelInfo).Capabilities.Vision {
+		t.Error("vision not reported while file upload is enabled")
+	}
+}
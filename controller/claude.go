@@ -0,0 +1,296 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"getbind2api/common"
+	"getbind2api/common/config"
+	logger "getbind2api/common/loggger"
+	"getbind2api/common/metrics"
+	"getbind2api/cycletls"
+	"getbind2api/model"
+	"github.com/gin-gonic/gin"
+	"io"
+	"net/http"
+)
+
+const claudeMessageIDFormat = "msg_%s"
+
+// ChatForClaude @Summary Anthropic Messages对话接口
+// @Description Anthropic Messages对话接口
+// @Tags Anthropic
+// @Accept json
+// @Produce json
+// @Param req body model.ClaudeCompletionRequest true "Anthropic Messages对话请求"
+// @Param x-api-key header string true "API-KEY"
+// @Router /v1/messages [post]
+func ChatForClaude(c *gin.Context) {
+	client := cycletls.Init()
+	defer safeClose(client)
+
+	var claudeReq model.ClaudeCompletionRequest
+	if err := c.BindJSON(&claudeReq); err != nil {
+		logger.Errorf(c.Request.Context(), "%s", err.Error())
+		sendClaudeError(c, http.StatusBadRequest, "invalid_request_error", "Invalid request parameters")
+		return
+	}
+
+	metrics.SetRequestLabels(c, claudeReq.Model, claudeReq.Stream)
+
+	modelInfo, b := common.GetModelInfo(claudeReq.Model)
+	if !b {
+		sendClaudeError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Model %s not supported", claudeReq.Model))
+		return
+	}
+	// 别名统一为对外的模型名
+	claudeReq.Model = modelInfo.Id
+	if claudeReq.MaxTokens > modelInfo.MaxTokens {
+		sendClaudeError(c, http.StatusBadRequest, "invalid_request_error", fmt.Sprintf("Max tokens %d exceeds limit %d", claudeReq.MaxTokens, modelInfo.MaxTokens))
+		return
+	}
+
+	openAIReq := model.ConvertClaudeToOpenAIRequest(claudeReq)
+	openAIReq.RemoveEmptyContentMessages()
+	if relayErr := checkApiKeyQuota(c, &openAIReq); relayErr != nil {
+		sendClaudeError(c, relayErr.StatusCode, claudeErrorType(relayErr), relayErr.Message)
+		return
+	}
+
+	if claudeReq.Stream {
+		handleClaudeStreamRequest(c, client, openAIReq, modelInfo)
+	} else {
+		handleClaudeNonStreamRequest(c, client, openAIReq, modelInfo)
+	}
+}
+
+func handleClaudeNonStreamRequest(c *gin.Context, client cycletls.CycleTLS, openAIReq model.OpenAIChatCompletionRequest, modelInfo common.ModelInfo) {
+	var assistantMsgContent string
+	var reasoningContent string
+	var promptTokens int
+	completed := false
+	thinkParser := newThinkParser(modelInfo)
+
+	relayErr := relayChat(c, client, &openAIReq, modelInfo, func(data string, requestTokens int) bool {
+		reasoning, delta, shouldContinue := processNoStreamData(c, data, modelInfo, thinkParser)
+		reasoningContent = reasoningContent + reasoning
+		assistantMsgContent = assistantMsgContent + delta
+		if !shouldContinue {
+			promptTokens = requestTokens
+			completed = true
+			return false
+		}
+		return true
+	})
+	if relayErr.isClientCancelled() {
+		c.Status(relayErr.StatusCode)
+		return
+	}
+	if relayErr != nil {
+		sendClaudeError(c, relayErr.StatusCode, claudeErrorType(relayErr), relayErr.Message)
+		return
+	}
+	if !completed {
+		return
+	}
+
+	var content []model.ClaudeContentBlock
+	if reasoningContent != "" && config.ReasoningHide != 1 {
+		content = append(content, model.ClaudeContentBlock{
+			Type:     "thinking",
+			Thinking: reasoningContent,
+		})
+	}
+	content = append(content, model.ClaudeContentBlock{
+		Type: "text",
+		Text: assistantMsgContent,
+	})
+
+	stopReason := "end_turn"
+	c.JSON(http.StatusOK, model.ClaudeMessagesResponse{
+		ID:         fmt.Sprintf(claudeMessageIDFormat, common.GetUUID()[:24]),
+		Type:       "message",
+		Role:       "assistant",
+		Model:      openAIReq.Model,
+		Content:    content,
+		StopReason: &stopReason,
+		Usage: model.ClaudeUsage{
+			InputTokens:  promptTokens,
+			OutputTokens: model.CountTokenText(reasoningContent+assistantMsgContent, openAIReq.Model),
+		},
+	})
+}
+
+func handleClaudeStreamRequest(c *gin.Context, client cycletls.CycleTLS, openAIReq model.OpenAIChatCompletionRequest, modelInfo common.ModelInfo) {
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+
+	messageId := fmt.Sprintf(claudeMessageIDFormat, common.GetUUID()[:24])
+	started := false
+	var assistantMsgContent string
+	thinkParser := newThinkParser(modelInfo)
+	blocks := &claudeBlockWriter{c: c, index: -1}
+
+	c.Stream(func(w io.Writer) bool {
+		relayErr := relayChat(c, client, &openAIReq, modelInfo, func(data string, promptTokens int) bool {
+			if !started {
+				started = true
+				sendClaudeEvent(c, model.ClaudeStreamEvent{
+					Type: "message_start",
+					Message: &model.ClaudeMessagesResponse{
+						ID:      messageId,
+						Type:    "message",
+						Role:    "assistant",
+						Model:   openAIReq.Model,
+						Content: []model.ClaudeContentBlock{},
+						Usage: model.ClaudeUsage{
+							InputTokens: promptTokens,
+						},
+					},
+				})
+				sendClaudeEvent(c, model.ClaudeStreamEvent{Type: "ping"})
+			}
+
+			var reasoning, content string
+			if data == "[DONE]" {
+				reasoning, content = flushThink(thinkParser)
+			} else {
+				reasoning, content = splitThink(thinkParser, data)
+			}
+			assistantMsgContent = assistantMsgContent + reasoning + content
+
+			if reasoning != "" && config.ReasoningHide != 1 {
+				if blocks.write("thinking", reasoning) != nil {
+					return false
+				}
+			}
+			if content != "" {
+				if blocks.write("text", content) != nil {
+					return false
+				}
+			}
+
+			if data == "[DONE]" {
+				if blocks.index < 0 {
+					// 没有任何输出时也返回一个空的文本块
+					blocks.start("text")
+				}
+				blocks.stop()
+
+				stopReason := "end_turn"
+				sendClaudeEvent(c, model.ClaudeStreamEvent{
+					Type:  "message_delta",
+					Delta: model.ClaudeMessageDelta{StopReason: &stopReason},
+					Usage: &model.ClaudeUsage{
+						OutputTokens: model.CountTokenText(assistantMsgContent, openAIReq.Model),
+					},
+				})
+				sendClaudeEvent(c, model.ClaudeStreamEvent{Type: "message_stop"})
+				return false
+			}
+			return true
+		})
+		if relayErr.isClientCancelled() {
+			c.Status(relayErr.StatusCode)
+			return false
+		}
+		if relayErr != nil {
+			if started {
+				sendClaudeEvent(c, model.ClaudeStreamEvent{
+					Type:  "error",
+					Error: &model.ClaudeError{Type: claudeErrorType(relayErr), Message: relayErr.Message},
+				})
+			} else {
+				sendClaudeError(c, relayErr.StatusCode, claudeErrorType(relayErr), relayErr.Message)
+			}
+		}
+		return false
+	})
+}
+
+// claudeBlockWriter 管理流式输出中内容块的开始与结束
+type claudeBlockWriter struct {
+	c         *gin.Context
+	index     int
+	blockType string
+	open      bool
+}
+
+func (w *claudeBlockWriter) start(blockType string) {
+	w.index++
+	w.blockType = blockType
+	w.open = true
+	index := w.index
+	sendClaudeEvent(w.c, model.ClaudeStreamEvent{
+		Type:         "content_block_start",
+		Index:        &index,
+		ContentBlock: &model.ClaudeContentBlock{Type: blockType},
+	})
+}
+
+func (w *claudeBlockWriter) stop() {
+	if !w.open {
+		return
+	}
+	w.open = false
+	index := w.index
+	sendClaudeEvent(w.c, model.ClaudeStreamEvent{
+		Type:  "content_block_stop",
+		Index: &index,
+	})
+}
+
+// write 向指定类型的内容块写入增量,类型变化时先结束上一个内容块
+func (w *claudeBlockWriter) write(blockType, text string) error {
+	if !w.open || w.blockType != blockType {
+		w.stop()
+		w.start(blockType)
+	}
+	index := w.index
+	var delta interface{} = model.ClaudeTextDelta{Type: "text_delta", Text: text}
+	if blockType == "thinking" {
+		delta = model.ClaudeThinkingDelta{Type: "thinking_delta", Thinking: text}
+	}
+	return sendClaudeEvent(w.c, model.ClaudeStreamEvent{
+		Type:  "content_block_delta",
+		Index: &index,
+		Delta: delta,
+	})
+}
+
+// sendClaudeEvent 按Anthropic格式发送SSE事件
+func sendClaudeEvent(c *gin.Context, event model.ClaudeStreamEvent) error {
+	jsonResp, err := json.Marshal(event)
+	if err != nil {
+		logger.Errorf(c.Request.Context(), "Failed to marshal event: %v", err)
+		return err
+	}
+	if _, err = fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event.Type, jsonResp); err != nil {
+		return err
+	}
+	c.Writer.Flush()
+	return nil
+}
+
+// claudeErrorType 将上游请求失败的原因转换为Anthropic错误类型
+func claudeErrorType(relayErr *relayError) string {
+	switch relayErr.StatusCode {
+	case http.StatusBadRequest:
+		return "invalid_request_error"
+	case http.StatusForbidden:
+		return "permission_error"
+	case http.StatusTooManyRequests:
+		return "rate_limit_error"
+	}
+	return "api_error"
+}
+
+func sendClaudeError(c *gin.Context, statusCode int, errorType, message string) {
+	c.JSON(statusCode, model.ClaudeErrorResponse{
+		Type: "error",
+		Error: model.ClaudeError{
+			Type:    errorType,
+			Message: message,
+		},
+	})
+}
@@ -0,0 +1,374 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"getbind2api/common"
+	"getbind2api/common/config"
+	logger "getbind2api/common/loggger"
+	"getbind2api/cycletls"
+	"getbind2api/getbind-api"
+	"getbind2api/model"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	fileFetchTimeout      = 30 * time.Second // 下载远程文件的超时时间
+	fileFetchMaxRedirects = 3
+)
+
+var errFileHostNotAllowed = errors.New("file host is not a public address")
+
+// fileFetchClient 下载客户端提供的远程文件,只允许连接公网地址,避免通过文件地址访问内网服务
+var fileFetchClient = &http.Client{
+	Timeout: fileFetchTimeout,
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: checkPublicAddress,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: fileFetchTimeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	},
+	// 重定向后的地址在建立连接时同样会被检查
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= fileFetchMaxRedirects {
+			return fmt.Errorf("stopped after %d redirects", fileFetchMaxRedirects)
+		}
+		if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+			return fmt.Errorf("unsupported redirect scheme %s", req.URL.Scheme)
+		}
+		return nil
+	},
+}
+
+// nonPublicNetworks 除 net.IP 方法已覆盖的地址外,不允许连接的网段
+var nonPublicNetworks = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),
+	mustParseCIDR("100.64.0.0/10"), // 运营商级NAT
+	mustParseCIDR("192.0.0.0/24"),
+	mustParseCIDR("198.18.0.0/15"),
+	mustParseCIDR("64:ff9b::/96"), // NAT64,可映射到内网IPv4地址
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// checkPublicAddress 在DNS解析之后、建立连接之前检查目标IP,拒绝回环、内网、链路本地(含云厂商元数据地址)等非公网地址
+func checkPublicAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublicIP(ip) {
+		return fmt.Errorf("%w: %s", errFileHostNotAllowed, host)
+	}
+	return nil
+}
+
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		!ip.IsGlobalUnicast() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+var imageMimeTypes = map[string]bool{
+	common.JPG_TYPE:  true,
+	common.PNG_TYPE:  true,
+	common.WEBP_TYPE: true,
+}
+
+var documentMimeTypes = map[string]bool{
+	common.TXT_TYPE:  true,
+	common.PDF_TYPE:  true,
+	common.DOC_TYPE:  true,
+	common.DOCX_TYPE: true,
+}
+
+// fileMaxSize 返回各类型文件的大小上限(MB)
+func fileMaxSize(mimeType string) int {
+	switch {
+	case imageMimeTypes[mimeType]:
+		return config.ImageMaxSize
+	case mimeType == common.TXT_TYPE:
+		return config.TextMaxSize
+	}
+	return config.DocumentMaxSize
+}
+
+func invalidFileError(format string, args ...interface{}) *relayError {
+	return newRelayError(http.StatusBadRequest, "invalid_file", fmt.Sprintf(format, args...))
+}
+
+var errFileUploadDisabled = newRelayError(http.StatusBadRequest, "file_upload_disabled", "Image and document inputs are not supported: file upload is disabled (FILE_UPLOAD_ENABLE)")
+
+// fileCache 一次对话请求中已读取与已上传的文件,更换路线或账号重试时不再重复下载与上传
+type fileCache struct {
+	loaded   map[string]loadedFile                // 按来源(远程地址或base64)缓存
+	uploaded map[string]*getbind_api.UploadedFile // 按账号与来源缓存,上传的文件只能由上传它的账号引用
+}
+
+type loadedFile struct {
+	data     []byte
+	fileType *common.FileTypeResult
+}
+
+func newFileCache() *fileCache {
+	return &fileCache{
+		loaded:   map[string]loadedFile{},
+		uploaded: map[string]*getbind_api.UploadedFile{},
+	}
+}
+
+func fileSourceKey(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
+
+// load 读取并校验文件,同一来源只读取一次
+func (fc *fileCache) load(ctx context.Context, source string, allowed map[string]bool) ([]byte, *common.FileTypeResult, error) {
+	key := fileSourceKey(source)
+	if file, ok := fc.loaded[key]; ok && allowed[file.fileType.MimeType] {
+		return file.data, file.fileType, nil
+	}
+	data, fileType, err := loadFile(ctx, source, allowed)
+	if err != nil {
+		return nil, nil, err
+	}
+	fc.loaded[key] = loadedFile{data: data, fileType: fileType}
+	return data, fileType, nil
+}
+
+// upload 将文件上传至上游,同一账号的同一来源只上传一次
+func (fc *fileCache) upload(ctx context.Context, client cycletls.CycleTLS, cookie string, routes *getbind_api.Routes, source, name string, data []byte, fileType *common.FileTypeResult) (*getbind_api.UploadedFile, error) {
+	key := cookie + "\x00" + fileSourceKey(source)
+	if file, ok := fc.uploaded[key]; ok {
+		logger.Debugf(ctx, "Reuse uploaded file %s", file.FileId)
+		return file, nil
+	}
+	file, err := uploadFile(ctx, client, cookie, routes, name, data, fileType)
+	if err != nil {
+		return nil, err
+	}
+	fc.uploaded[key] = file
+	return file, nil
+}
+
+// uploadMessageFiles 将消息中的图片与文档上传至上游,返回替换为上游引用后的消息列表与 files 字段。
+// 纯文本文件直接展开为文本内容,不修改传入的消息
+func uploadMessageFiles(ctx context.Context, client cycletls.CycleTLS, cookie string, routes *getbind_api.Routes, cache *fileCache, messages []model.OpenAIChatMessage) ([]model.OpenAIChatMessage, string, error) {
+	files := map[string]*getbind_api.UploadedFile{}
+	result := make([]model.OpenAIChatMessage, len(messages))
+	for i, msg := range messages {
+		result[i] = msg
+		parts, ok := msg.Content.([]interface{})
+		if !ok {
+			continue
+		}
+
+		newParts := make([]interface{}, 0, len(parts))
+		for _, part := range parts {
+			partMap, ok := part.(map[string]interface{})
+			if !ok {
+				newParts = append(newParts, part)
+				continue
+			}
+
+			switch partMap["type"] {
+			case "image_url":
+				if !config.FileUploadEnable {
+					return nil, "", errFileUploadDisabled
+				}
+				imageUrl, _ := partMap["image_url"].(map[string]interface{})
+				url, _ := imageUrl["url"].(string)
+				if url == "" {
+					return nil, "", invalidFileError("image_url.url is required")
+				}
+
+				data, fileType, err := cache.load(ctx, url, imageMimeTypes)
+				if err != nil {
+					return nil, "", err
+				}
+				file, err := cache.upload(ctx, client, cookie, routes, url, fmt.Sprintf("image%d%s", len(files)+1, fileType.Extension), data, fileType)
+				if err != nil {
+					return nil, "", err
+				}
+				files[file.FileId] = file
+				newParts = append(newParts, map[string]interface{}{
+					"type":      "image_url",
+					"image_url": map[string]interface{}{"url": file.Url},
+				})
+			case "file":
+				filePart, _ := partMap["file"].(map[string]interface{})
+				fileData, _ := filePart["file_data"].(string)
+				filename, _ := filePart["filename"].(string)
+				if fileData == "" {
+					return nil, "", invalidFileError("file.file_data is required")
+				}
+
+				data, fileType, err := cache.load(ctx, fileData, documentMimeTypes)
+				if err != nil {
+					return nil, "", err
+				}
+				if filename == "" {
+					filename = fmt.Sprintf("file%d%s", len(files)+1, fileType.Extension)
+				}
+
+				// 纯文本文件无需上传,直接作为文本发送
+				if fileType.MimeType == common.TXT_TYPE {
+					newParts = append(newParts, map[string]interface{}{
+						"type": "text",
+						"text": fmt.Sprintf("[File: %s]\n%s", filename, string(data)),
+					})
+					continue
+				}
+
+				if !config.FileUploadEnable {
+					return nil, "", errFileUploadDisabled
+				}
+				file, err := cache.upload(ctx, client, cookie, routes, fileData, filename, data, fileType)
+				if err != nil {
+					return nil, "", err
+				}
+				files[file.FileId] = file
+				newParts = append(newParts, map[string]interface{}{
+					"type": "file",
+					"file": map[string]interface{}{
+						"file_id":  file.FileId,
+						"filename": file.Name,
+						"url":      file.Url,
+					},
+				})
+			default:
+				newParts = append(newParts, part)
+			}
+		}
+		result[i].Content = newParts
+	}
+
+	if len(files) == 0 {
+		return result, "{}", nil
+	}
+	filesJSON, err := json.Marshal(files)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to marshal files: %v", err)
+	}
+	return result, string(filesJSON), nil
+}
+
+// loadFile 读取 data URI、base64 或远程地址中的文件,校验类型与大小
+func loadFile(ctx context.Context, url string, allowed map[string]bool) ([]byte, *common.FileTypeResult, error) {
+	var base64Str string
+	if strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://") {
+		bytes, err := fetchFileBytes(ctx, url, maxAllowedSize(allowed))
+		if err != nil {
+			logger.Errorf(ctx, "fetchFileBytes err: %v", err)
+			return nil, nil, invalidFileError("Failed to fetch file: %v", err)
+		}
+		base64Str = base64.StdEncoding.EncodeToString(bytes)
+	} else {
+		base64Str = url
+	}
+
+	// 检查类型
+	fileType := common.DetectFileType(base64Str)
+	if !fileType.IsValid || !allowed[fileType.MimeType] {
+		mimeType := fileType.MimeType
+		if mimeType == "" {
+			mimeType = fileType.Description
+		}
+		return nil, nil, invalidFileError("Unsupported file type: %s", mimeType)
+	}
+
+	if commaIndex := strings.Index(base64Str, ","); commaIndex != -1 {
+		base64Str = base64Str[commaIndex+1:]
+	}
+	data, err := base64.StdEncoding.DecodeString(base64Str)
+	if err != nil {
+		return nil, nil, invalidFileError("Invalid base64 file data")
+	}
+	if maxSize := fileMaxSize(fileType.MimeType); len(data) > maxSize<<20 {
+		return nil, nil, invalidFileError("File type %s exceeds size limit %dMB", fileType.MimeType, maxSize)
+	}
+	return data, fileType, nil
+}
+
+func uploadFile(ctx context.Context, client cycletls.CycleTLS, cookie string, routes *getbind_api.Routes, name string, data []byte, fileType *common.FileTypeResult) (*getbind_api.UploadedFile, error) {
+	file, err := getbind_api.UploadFile(ctx, client, cookie, routes, name, data, fileType)
+	if err != nil {
+		logger.Errorf(ctx, "UploadFile err: %v", err)
+		if errors.Is(err, getbind_api.ErrUpstreamBlocked) {
+			return nil, errUpstreamBlocked
+		}
+		return nil, newRelayError(http.StatusInternalServerError, "upload_error", err.Error())
+	}
+	return file, nil
+}
+
+// maxAllowedSize 返回允许类型中最大的大小上限(MB),用于限制远程文件下载
+func maxAllowedSize(allowed map[string]bool) int {
+	maxSize := 0
+	for mimeType := range allowed {
+		if size := fileMaxSize(mimeType); size > maxSize {
+			maxSize = size
+		}
+	}
+	return maxSize
+}
+
+// fetchFileBytes 通过 fileFetchClient 下载远程文件,超过大小上限时返回错误
+func fetchFileBytes(ctx context.Context, url string, maxSize int) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := fileFetchClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	maxBytes := int64(maxSize) << 20
+	if resp.ContentLength > maxBytes {
+		return nil, fmt.Errorf("file exceeds size limit %dMB", maxSize)
+	}
+	bytes, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(bytes)) > maxBytes {
+		return nil, fmt.Errorf("file exceeds size limit %dMB", maxSize)
+	}
+	return bytes, nil
+}
@@ -0,0 +1,255 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"getbind2api/common/config"
+	"getbind2api/cycletls"
+	"getbind2api/getbind-api/mock"
+	"getbind2api/middleware"
+	"getbind2api/model"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/pkoukk/tiktoken-go"
+)
+
+const (
+	openAIEndpoint = "/v1/chat/completions"
+	claudeEndpoint = "/v1/messages"
+)
+
+// byteBpeLoader 以单字节作为词表,测试时无需下载 tiktoken 编码文件
+type byteBpeLoader struct{}
+
+func (byteBpeLoader) LoadTiktokenBpe(string) (map[string]int, error) {
+	ranks := make(map[string]int, 256)
+	for i := 0; i < 256; i++ {
+		ranks[string([]byte{byte(i)})] = i
+	}
+	return ranks, nil
+}
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	tiktoken.SetBpeLoader(byteBpeLoader{})
+	model.InitTokenEncoders()
+
+	dataPath, err := os.MkdirTemp("", "getbind2api-controller-test")
+	if err != nil {
+		panic(err)
+	}
+	config.DataPath = dataPath
+	config.CookieSelectStrategy = config.CookieStrategyWeighted
+	config.CloudflareBenchDuration = 0
+	if err = config.InitDB(); err != nil {
+		panic(err)
+	}
+	if err = config.InitSGCookies(); err != nil {
+		panic(err)
+	}
+	if err = config.InitApiKeys(); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	_ = config.CloseDB()
+	_ = os.RemoveAll(dataPath)
+	os.Exit(code)
+}
+
+// newMockUpstream 启动 mock 上游并将请求指向它,测试结束后恢复
+func newMockUpstream(t *testing.T) *mock.Server {
+	t.Helper()
+	srv := mock.NewServer()
+	ts := httptest.NewServer(srv)
+	baseUrl := config.UpstreamBaseUrl
+	config.UpstreamBaseUrl = ts.URL
+	t.Cleanup(func() {
+		config.UpstreamBaseUrl = baseUrl
+		ts.Close()
+	})
+	return srv
+}
+
+var cookieSeq atomic.Int64
+
+// newCookie 以内置场景的前缀生成本次测试独有的cookie,避免测试之间共享限流与隔离状态
+func newCookie(prefix string) string {
+	return fmt.Sprintf("%s-%d", prefix, cookieSeq.Add(1))
+}
+
+// useCookies 将cookie池替换为给定的cookie,并按 weighted 策略让排在前面的cookie几乎总是先被选中。
+// 相邻cookie的权重相差 1e9 倍,测试最多使用两三个cookie,选错顺序的概率可以忽略
+func useCookies(t *testing.T, cookies ...string) {
+	t.Helper()
+	for _, info := range config.ListCookies() {
+		if err := config.DeleteCookie(info.UserId); err != nil {
+			t.Fatalf("DeleteCookie: %v", err)
+		}
+	}
+	if _, err := config.AddCookies(cookies); err != nil {
+		t.Fatalf("AddCookies: %v", err)
+	}
+	weight := 1
+	for i := len(cookies) - 1; i >= 0; i-- {
+		w := weight
+		if err := config.SetCookieSettings(cookies[i], &w, nil, nil); err != nil {
+			t.Fatalf("SetCookieSettings: %v", err)
+		}
+		weight *= 1_000_000_000
+	}
+}
+
+// cookieStatus 返回cookie池中cookie的健康状态
+func cookieStatus(t *testing.T, cookie string) string {
+	t.Helper()
+	for _, info := range config.ListCookies() {
+		if info.UserId == cookie {
+			return info.Status
+		}
+	}
+	t.Fatalf("cookie %s not in pool", cookie)
+	return ""
+}
+
+// newTestServer 只注册对话接口,与 router.SetApiRouter 使用相同的鉴权中间件,返回服务地址
+func newTestServer(t *testing.T) string {
+	t.Helper()
+	router := gin.New()
+	v1Router := router.Group("/v1")
+	v1Router.Use(middleware.OpenAIAuth())
+	v1Router.POST("/chat/completions", ChatForOpenAI)
+	v1Router.POST("/messages", ChatForClaude)
+	ts := httptest.NewServer(router)
+	t.Cleanup(ts.Close)
+	return ts.URL
+}
+
+type testMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// chatRequest 测试使用的对话请求,endpoint 为 OpenAI 或 Anthropic 接口
+type chatRequest struct {
+	endpoint string
+	model    string
+	stream   bool
+	apiKey   string
+	messages []testMessage
+}
+
+// newHTTPRequest 构造发往 baseUrl 的对话请求
+func (r chatRequest) newHTTPRequest(t *testing.T, ctx context.Context, baseUrl string) *http.Request {
+	t.Helper()
+	body, err := json.Marshal(map[string]interface{}{
+		"model":      r.model,
+		"stream":     r.stream,
+		"max_tokens": 1024,
+		"messages":   r.messages,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, baseUrl+r.endpoint, bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.apiKey)
+	}
+	return req
+}
+
+// doChat 发送对话请求,返回状态码与响应体
+func doChat(t *testing.T, baseUrl string, r chatRequest) (int, []byte) {
+	t.Helper()
+	resp, err := http.DefaultClient.Do(r.newHTTPRequest(t, context.Background(), baseUrl))
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read response failed: %v", err)
+	}
+	return resp.StatusCode, body
+}
+
+// chatReply 解析四种响应格式,返回思考内容、正文与流式响应中的错误事件
+func chatReply(t *testing.T, r chatRequest, body []byte) (reasoning, text string, errMessage string) {
+	t.Helper()
+	if !r.stream {
+		if r.endpoint == openAIEndpoint {
+			var resp model.OpenAIChatCompletionResponse
+			if err := json.Unmarshal(body, &resp); err != nil || len(resp.Choices) == 0 {
+				t.Fatalf("invalid response %s: %v", body, err)
+			}
+			return resp.Choices[0].Message.ReasoningContent, resp.Choices[0].Message.Content, ""
+		}
+		var resp model.ClaudeMessagesResponse
+		if err := json.Unmarshal(body, &resp); err != nil {
+			t.Fatalf("invalid response %s: %v", body, err)
+		}
+		for _, block := range resp.Content {
+			reasoning += block.Thinking
+			text += block.Text
+		}
+		return reasoning, text, ""
+	}
+
+	decoder := cycletls.NewSSEDecoder(bytes.NewReader(body))
+	for {
+		event, err := decoder.Next()
+		if err == io.EOF {
+			return reasoning, text, errMessage
+		}
+		if err != nil {
+			t.Fatalf("invalid stream %s: %v", body, err)
+		}
+		data := strings.TrimSpace(event.Data)
+		if data == "[DONE]" {
+			continue
+		}
+		var chunk struct {
+			Choices []struct {
+				Delta struct {
+					Content          string `json:"content"`
+					ReasoningContent string `json:"reasoning_content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Type  string `json:"type"`
+			Delta struct {
+				Text     string `json:"text"`
+				Thinking string `json:"thinking"`
+			} `json:"delta"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			t.Fatalf("invalid stream chunk %q: %v", data, err)
+		}
+		for _, choice := range chunk.Choices {
+			reasoning += choice.Delta.ReasoningContent
+			text += choice.Delta.Content
+		}
+		if chunk.Type == "content_block_delta" {
+			reasoning += chunk.Delta.Thinking
+			text += chunk.Delta.Text
+		}
+		if chunk.Error != nil {
+			errMessage = chunk.Error.Message
+		}
+	}
+}
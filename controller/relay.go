@@ -0,0 +1,297 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"getbind2api/common"
+	"getbind2api/common/config"
+	"getbind2api/common/helper"
+	logger "getbind2api/common/loggger"
+	"getbind2api/common/metrics"
+	"getbind2api/cycletls"
+	"getbind2api/getbind-api"
+	"getbind2api/model"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// relayError 上游请求失败的原因,由各协议的处理函数转换为对应格式的错误响应
+type relayError struct {
+	StatusCode int
+	Code       string
+	Message    string
+}
+
+func (e *relayError) Error() string {
+	return e.Message
+}
+
+// statusClientClosedRequest 客户端在响应完成前断开连接(沿用nginx的499状态码)
+const statusClientClosedRequest = 499
+
+// errClientCancelled 客户端主动断开,无需再向客户端写入错误响应
+var errClientCancelled = newRelayError(statusClientClosedRequest, "client_cancelled", "Request cancelled by client")
+
+// errCodeUpstreamBlocked 请求在所有可用路线上都被 Cloudflare 拦截
+const errCodeUpstreamBlocked = "upstream_blocked"
+
+var errUpstreamBlocked = newRelayError(http.StatusServiceUnavailable, errCodeUpstreamBlocked, "Upstream request blocked by Cloudflare on all routes")
+
+// isClientCancelled 判断请求是否因客户端断开而结束
+func (e *relayError) isClientCancelled() bool {
+	return e != nil && e.Code == errClientCancelled.Code
+}
+
+func newRelayError(statusCode int, code, message string) *relayError {
+	return &relayError{
+		StatusCode: statusCode,
+		Code:       code,
+		Message:    message,
+	}
+}
+
+// relayHandler 依次接收上游返回的数据,data 为 "[DONE]" 表示输出结束。
+// promptTokens 为本次发往上游的消息的token数,返回 false 时停止读取。
+type relayHandler func(data string, promptTokens int) bool
+
+// relayChat 从cookie池中选取cookie向上游发起对话,
+// cookie未登录或被限流时自动切换到下一个cookie重试,被 Cloudflare 拦截时更换代理或浏览器指纹重试
+func relayChat(c *gin.Context, client cycletls.CycleTLS, openAIReq *model.OpenAIChatCompletionRequest, modelInfo common.ModelInfo, handler relayHandler) *relayError {
+	ctx := c.Request.Context()
+	if err := prepareRequest(openAIReq); err != nil {
+		return newRelayError(http.StatusInternalServerError, "request_error", err.Error())
+	}
+
+	// 多轮对话命中会话缓存时优先使用该会话所属的账号,只发送新增的消息
+	apiKeyId := c.GetString(helper.ApiKeyIdKey)
+	upstreamSess := lookupSession(ctx, apiKeyId, modelInfo, openAIReq)
+	sessionMessages := openAIReq.Messages
+	cookieManager := config.NewCookieManager()
+	cookieManager.StickyKey = apiKeyId
+	if upstreamSess != nil {
+		cookieManager.Preferred = upstreamSess.Cookie
+	}
+	maxRetries := len(cookieManager.Cookies)
+	cookie, err := cookieManager.SelectCookie()
+	if err != nil {
+		return cookieSelectError(err)
+	}
+	// 请求结束后释放当前cookie的并发名额
+	defer func() {
+		cookieManager.ReleaseCookie(cookie)
+	}()
+
+	if openAIReq.Stream {
+		metrics.ActiveStreams.Inc()
+		defer metrics.ActiveStreams.Dec()
+	}
+
+	// 统计实际产生输出的那次请求的token数
+	promptTokens := -1
+	var completion strings.Builder
+	defer func() {
+		c.Set(helper.CookieKey, cookie)
+		if promptTokens >= 0 {
+			completionTokens := model.CountTokenText(completion.String(), openAIReq.Model)
+			c.Set(helper.PromptTokensKey, promptTokens)
+			c.Set(helper.CompletionTokensKey, completionTokens)
+			metrics.AddTokens(openAIReq.Model, promptTokens, completionTokens)
+			config.RecordApiKeyUsage(apiKeyId, promptTokens, completionTokens)
+		}
+	}()
+
+	routes := &getbind_api.Routes{}
+	files := newFileCache()
+	trimmed := false
+	for attempt := 0; attempt < maxRetries; {
+		// 未复用上游会话(未命中缓存,或会话所属账号不可用而换了账号)时发送完整的消息列表,需先裁剪
+		if !upstreamSess.reusableWith(cookie) && !trimmed {
+			if relayErr := trimContext(c, openAIReq, modelInfo); relayErr != nil {
+				return relayErr
+			}
+			trimmed = true
+		}
+		requestBody, err := createRequestBody(c, client, openAIReq, modelInfo, cookie, routes, files, upstreamSess)
+		if err != nil {
+			var relayErr *relayError
+			if errors.As(err, &relayErr) {
+				if relayErr.Code == errCodeUpstreamBlocked {
+					if !blockRoute(ctx, routes, attempt, maxRetries) {
+						return errUpstreamBlocked
+					}
+					continue
+				}
+				return relayErr
+			}
+			return newRelayError(http.StatusInternalServerError, "request_error", err.Error())
+		}
+
+		requestTokens := openAIReq.CountPromptTokens()
+		sseChan, err := getbind_api.MakeStreamChatRequest(ctx, client, requestBody, cookie, modelInfo, routes)
+		if err != nil {
+			logger.Errorf(ctx, "MakeStreamChatRequest err on attempt %d: %v", attempt+1, err)
+			return newRelayError(http.StatusInternalServerError, "upstream_error", err.Error())
+		}
+
+		isRateLimit := false
+		isBlocked := false
+	SSELoop:
+		for response := range sseChan {
+			data := response.Data
+			if data == "" {
+				continue
+			}
+
+			if response.Done && data != "[DONE]" {
+				metrics.UpstreamErrors.WithLabelValues(upstreamErrorClass(response.Status, data)).Inc()
+				switch {
+				case common.IsServerError(data):
+					logger.Errorf(ctx, errServerErrMsg)
+					return newRelayError(http.StatusInternalServerError, "upstream_unavailable", errServerErrMsg)
+				case common.IsNotLogin(data):
+					isRateLimit = true
+					logger.Warnf(ctx, "Cookie Not Login, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
+					quarantineCookie(ctx, cookie, config.CookieStatusInvalid, data)
+					break SSELoop // 使用 label 跳出 SSE 循环
+				case common.IsUsageLimitExceeded(data):
+					isRateLimit = true
+					logger.Warnf(ctx, "Cookie usage limit exceeded, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
+					quarantineCookie(ctx, cookie, config.CookieStatusUsageExhausted, data)
+					break SSELoop
+				case common.IsRateLimit(data):
+					isRateLimit = true
+					logger.Warnf(ctx, "Cookie rate limited, switching to next cookie, attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
+					if err := config.AddRateLimitCookie(cookie, time.Now().Add(time.Duration(config.RateLimitCookieLockDuration)*time.Second)); err != nil {
+						logger.Errorf(ctx, "Failed to save cookie pool: %v", err)
+					}
+					break SSELoop
+				case getbind_api.IsUpstreamBlocked(data):
+					isBlocked = true
+					break SSELoop
+				case response.Status == http.StatusForbidden:
+					logger.Warnf(ctx, "%s", data)
+					return newRelayError(http.StatusInternalServerError, "upstream_forbidden", "Forbidden")
+				}
+				logger.Warnf(ctx, "%s", data)
+				return newRelayError(http.StatusInternalServerError, "upstream_error", data)
+			}
+
+			logger.Debug(ctx, data)
+
+			if data == "[DONE]" {
+				sessionId, _ := requestBody["session_id"].(string)
+				storeSession(ctx, apiKeyId, modelInfo, sessionMessages, completion.String(), cookie, sessionId)
+			} else {
+				if promptTokens < 0 {
+					promptTokens = requestTokens
+					metrics.ObserveFirstToken(c)
+				}
+				completion.WriteString(data)
+			}
+
+			if !handler(data, requestTokens) {
+				return nil
+			}
+		}
+
+		// 客户端断开时上游连接已被关闭,记录为取消而非失败
+		if ctx.Err() != nil {
+			logger.Infof(ctx, "Request cancelled by client on attempt %d/%d, COOKIE:%s", attempt+1, maxRetries, cookie)
+			return errClientCancelled
+		}
+
+		// 被拦截与账号无关,使用同一账号换一条路线重试,不计入账号的重试次数,
+		// 次数由 CLOUDFLARE_MAX_RETRIES 单独限制
+		if isBlocked {
+			if !blockRoute(ctx, routes, attempt, maxRetries) {
+				return errUpstreamBlocked
+			}
+			continue
+		}
+
+		if !isRateLimit {
+			return nil
+		}
+
+		// 获取下一个可用的cookie继续尝试
+		attempt++
+		cookieManager.ReleaseCookie(cookie)
+		cookie, err = cookieManager.SelectCookie()
+		if err != nil {
+			logger.Errorf(ctx, "No more valid cookies available after attempt %d: %v", attempt+1, err)
+			if errors.Is(err, config.ErrNoCookieAvailable) {
+				break
+			}
+			return cookieSelectError(err)
+		}
+	}
+
+	logger.Errorf(ctx, "All cookies exhausted after %d attempts", maxRetries)
+	return newRelayError(http.StatusInternalServerError, "cookies_exhausted", "All cookies are temporarily unavailable.")
+}
+
+// trimContext 按 CONTEXT_TRIM_STRATEGY 将提示词与 max_tokens 控制在模型上下文窗口内,
+// 裁剪情况通过响应头返回。上游的 context 字段不计入预算:对话请求从不设置该字段,
+// 历史消息全部放在 query 中,复用上游会话时的历史则由上游保存,不经过本服务
+func trimContext(c *gin.Context, openAIReq *model.OpenAIChatCompletionRequest, modelInfo common.ModelInfo) *relayError {
+	budget := modelInfo.MaxTokens - openAIReq.MaxTokens
+	result, err := openAIReq.TrimMessages(config.ContextTrimStrategy, budget)
+	if err != nil {
+		logger.Warnf(c.Request.Context(), "TrimMessages err: %v", err)
+		return newRelayError(http.StatusBadRequest, "context_length_exceeded", err.Error())
+	}
+	if result.TrimmedMessages > 0 {
+		logger.Infof(c.Request.Context(), "Trimmed %d messages (%d tokens) with strategy %s", result.TrimmedMessages, result.TrimmedTokens, config.ContextTrimStrategy)
+		c.Header("X-Context-Trim-Strategy", config.ContextTrimStrategy)
+		c.Header("X-Context-Trimmed-Messages", strconv.Itoa(result.TrimmedMessages))
+		c.Header("X-Context-Trimmed-Tokens", strconv.Itoa(result.TrimmedTokens))
+	}
+	return nil
+}
+
+// blockRoute 记录被 Cloudflare 拦截的路线,返回是否还可以换一条路线重试
+func blockRoute(ctx context.Context, routes *getbind_api.Routes, attempt, maxRetries int) bool {
+	if routes.Block() {
+		logger.Warnf(ctx, "Blocked by Cloudflare, route retry %d/%d on attempt %d/%d, ROUTE:%s", routes.Blocks(), config.CloudflareMaxRetries, attempt+1, maxRetries, routes.Current)
+		return true
+	}
+	logger.Errorf(ctx, "Blocked by Cloudflare on all routes after %d route retries on attempt %d/%d, ROUTE:%s", routes.Blocks()-1, attempt+1, maxRetries, routes.Current)
+	return false
+}
+
+// quarantineCookie 记录失效或额度用尽的cookie,后续请求不再使用
+func quarantineCookie(ctx context.Context, cookie, status, message string) {
+	if err := config.SetCookieStatus(cookie, status, message); err != nil {
+		logger.Errorf(ctx, "SetCookieStatus err: %v", err)
+	}
+}
+
+// cookieSelectError 将cookie选择失败转换为错误响应,所有账号并发已满时返回429
+func cookieSelectError(err error) *relayError {
+	if errors.Is(err, config.ErrCookiesBusy) {
+		return newRelayError(http.StatusTooManyRequests, "cookies_busy", err.Error())
+	}
+	return newRelayError(http.StatusInternalServerError, "no_available_cookie", err.Error())
+}
+
+// upstreamErrorClass 上游错误分类,用于监控统计
+func upstreamErrorClass(status int, data string) string {
+	switch {
+	case common.IsRateLimit(data):
+		return metrics.UpstreamErrorRateLimit
+	case common.IsNotLogin(data):
+		return metrics.UpstreamErrorNotLogin
+	case common.IsUsageLimitExceeded(data):
+		return metrics.UpstreamErrorUsageExhausted
+	case common.IsServerError(data) || status == http.StatusServiceUnavailable:
+		return metrics.UpstreamErrorServerError
+	case common.IsCloudflareBlock(data) || common.IsCloudflareChallenge(data):
+		return metrics.UpstreamErrorCloudflare
+	case status == http.StatusForbidden:
+		return metrics.UpstreamErrorForbidden
+	}
+	return metrics.UpstreamErrorOther
+}
@@ -0,0 +1,225 @@
+package controller
+
+import (
+	"context"
+	"getbind2api/common/config"
+	"getbind2api/getbind-api/mock"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+// chatVariants 每个场景都分别通过 OpenAI 与 Anthropic 接口、流式与非流式请求
+var chatVariants = []struct {
+	name     string
+	endpoint string
+	stream   bool
+}{
+	{"openai", openAIEndpoint, false},
+	{"openai_stream", openAIEndpoint, true},
+	{"claude", claudeEndpoint, false},
+	{"claude_stream", claudeEndpoint, true},
+}
+
+func TestRelayChatScenarios(t *testing.T) {
+	tests := []struct {
+		name         string
+		cookies      []string // 按顺序尝试的cookie所使用的 mock 内置场景,plain 为正常回复
+		wantStatus   int
+		wantMessage  string // 失败时错误信息包含的内容
+		wantRequests int    // mock 收到的对话请求数
+		check        func(t *testing.T, cookies []string)
+	}{
+		{
+			name:         "success",
+			cookies:      []string{"plain"},
+			wantStatus:   http.StatusOK,
+			wantRequests: 1,
+		},
+		{
+			name:         "slow",
+			cookies:      []string{mock.UserSlow},
+			wantStatus:   http.StatusOK,
+			wantRequests: 1,
+		},
+		{
+			name:         "ratelimit switches cookie",
+			cookies:      []string{mock.UserRateLimit, "plain"},
+			wantStatus:   http.StatusOK,
+			wantRequests: 2,
+			check: func(t *testing.T, cookies []string) {
+				if lo.Contains(config.NewCookieManager().Cookies, cookies[0]) {
+					t.Errorf("rate limited cookie %s is not locked", cookies[0])
+				}
+			},
+		},
+		{
+			name:         "invalid token switches cookie",
+			cookies:      []string{mock.UserInvalidToken, "plain"},
+			wantStatus:   http.StatusOK,
+			wantRequests: 2,
+			check: func(t *testing.T, cookies []string) {
+				if status := cookieStatus(t, cookies[0]); status != config.CookieStatusInvalid {
+					t.Errorf("status = %q, want %q", status, config.CookieStatusInvalid)
+				}
+			},
+		},
+		{
+			name:         "usage exhausted switches cookie",
+			cookies:      []string{mock.UserUsageExhausted, "plain"},
+			wantStatus:   http.StatusOK,
+			wantRequests: 2,
+			check: func(t *testing.T, cookies []string) {
+				if status := cookieStatus(t, cookies[0]); status != config.CookieStatusUsageExhausted {
+					t.Errorf("status = %q, want %q", status, config.CookieStatusUsageExhausted)
+				}
+			},
+		},
+		{
+			name:         "all cookies rate limited",
+			cookies:      []string{mock.UserRateLimit, mock.UserRateLimit},
+			wantStatus:   http.StatusInternalServerError,
+			wantMessage:  "All cookies are temporarily unavailable.",
+			wantRequests: 2,
+		},
+		{
+			name:         "503 does not switch cookie",
+			cookies:      []string{mock.UserServerError, "plain"},
+			wantStatus:   http.StatusInternalServerError,
+			wantMessage:  errServerErrMsg,
+			wantRequests: 1,
+		},
+		{
+			name:         "503 with empty body",
+			cookies:      []string{mock.UserServerErrorEmpty, "plain"},
+			wantStatus:   http.StatusInternalServerError,
+			wantMessage:  errServerErrMsg,
+			wantRequests: 1,
+		},
+		{
+			name:         "cloudflare block retries other routes",
+			cookies:      []string{mock.UserCloudflareBlock},
+			wantStatus:   http.StatusServiceUnavailable,
+			wantMessage:  errUpstreamBlocked.Message,
+			wantRequests: config.CloudflareMaxRetries + 1,
+		},
+	}
+
+	for _, tt := range tests {
+		for _, variant := range chatVariants {
+			t.Run(tt.name+"/"+variant.name, func(t *testing.T) {
+				srv := newMockUpstream(t)
+				baseUrl := newTestServer(t)
+				cookies := make([]string, len(tt.cookies))
+				for i, prefix := range tt.cookies {
+					cookies[i] = newCookie(prefix)
+				}
+				useCookies(t, cookies...)
+
+				req := chatRequest{
+					endpoint: variant.endpoint,
+					model:    "gpt-4o-mini",
+					stream:   variant.stream,
+					messages: []testMessage{{Role: "user", Content: "hello there"}},
+				}
+				status, body := doChat(t, baseUrl, req)
+				if status != tt.wantStatus {
+					t.Fatalf("status = %d, want %d, body: %s", status, tt.wantStatus, body)
+				}
+				if tt.wantStatus == http.StatusOK {
+					_, text, errMessage := chatReply(t, req, body)
+					if text != "Mock reply:\nhello there\n" || errMessage != "" {
+						t.Errorf("reply = %q, error = %q", text, errMessage)
+					}
+				} else if !strings.Contains(string(body), tt.wantMessage) {
+					t.Errorf("body = %s, want message %q", body, tt.wantMessage)
+				}
+
+				requests := srv.Requests()
+				if len(requests) != tt.wantRequests {
+					t.Fatalf("upstream requests = %d, want %d", len(requests), tt.wantRequests)
+				}
+				for i, upstreamReq := range requests {
+					if want := cookies[min(i, len(cookies)-1)]; upstreamReq.UserId != want {
+						t.Errorf("request %d user_id = %s, want %s", i, upstreamReq.UserId, want)
+					}
+				}
+				for _, cookie := range cookies {
+					if inFlight := config.CookieInFlight(cookie); inFlight != 0 {
+						t.Errorf("cookie %s in flight = %d after request", cookie, inFlight)
+					}
+				}
+				if tt.check != nil {
+					tt.check(t, cookies)
+				}
+			})
+		}
+	}
+}
+
+func TestRelayChatClientDisconnect(t *testing.T) {
+	for _, variant := range chatVariants {
+		t.Run(variant.name, func(t *testing.T) {
+			srv := newMockUpstream(t)
+			baseUrl := newTestServer(t)
+			cookie := newCookie(mock.UserSlow)
+			useCookies(t, cookie)
+
+			req := chatRequest{
+				endpoint: variant.endpoint,
+				model:    "gpt-4o-mini",
+				stream:   variant.stream,
+				messages: []testMessage{{Role: "user", Content: "a reply long enough to take a few seconds"}},
+			}
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if !variant.stream {
+				// 非流式请求在上游输出完成前不会返回,等上游开始输出后断开
+				go func() {
+					waitFor(t, func() bool { return len(srv.Requests()) == 1 })
+					time.Sleep(100 * time.Millisecond)
+					cancel()
+				}()
+			}
+			resp, err := http.DefaultClient.Do(req.newHTTPRequest(t, ctx, baseUrl))
+			if variant.stream {
+				if err != nil {
+					t.Fatalf("request failed: %v", err)
+				}
+				// 收到第一块输出后断开
+				buf := make([]byte, 1)
+				if _, err = resp.Body.Read(buf); err != nil {
+					t.Fatalf("read response failed: %v", err)
+				}
+				cancel()
+				_, _ = io.Copy(io.Discard, resp.Body)
+				resp.Body.Close()
+			} else if err == nil {
+				resp.Body.Close()
+				t.Fatalf("request completed with status %d, want cancelled", resp.StatusCode)
+			}
+
+			waitFor(t, func() bool { return srv.Cancelled() == 1 && config.CookieInFlight(cookie) == 0 })
+			if requests := srv.Requests(); len(requests) != 1 {
+				t.Errorf("upstream requests = %d, want 1", len(requests))
+			}
+		})
+	}
+}
+
+// waitFor 等待条件成立,超时后测试失败
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Errorf("condition not met within 5s")
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
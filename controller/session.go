@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"getbind2api/common"
+	logger "getbind2api/common/loggger"
+	"getbind2api/common/session"
+	"getbind2api/model"
+	"strings"
+)
+
+// upstreamSession 命中缓存的上游会话,NewMessages 为需要发送的新增消息数
+type upstreamSession struct {
+	session.Entry
+	NewMessages int
+}
+
+// reusableWith 判断使用该账号发送请求时能否复用上游会话,s 为nil时返回 false
+func (s *upstreamSession) reusableWith(cookie string) bool {
+	return s != nil && s.Cookie == cookie
+}
+
+// lookupSession 以截至最后一条assistant消息(含)的消息列表查询会话缓存,
+// 即上一轮请求的完整消息列表与其回复,新增的消息为最后一条assistant消息之后的部分。
+// 回复被编辑过时不会命中,命中的缓存被取出,重新生成回复时不会再次复用
+func lookupSession(ctx context.Context, apiKeyId string, modelInfo common.ModelInfo, openAIReq *model.OpenAIChatCompletionRequest) *upstreamSession {
+	if !session.Enabled() {
+		return nil
+	}
+
+	lastAssistant := -1
+	for i := len(openAIReq.Messages) - 1; i >= 0; i-- {
+		if openAIReq.Messages[i].Role == "assistant" {
+			lastAssistant = i
+			break
+		}
+	}
+	newMessages := len(openAIReq.Messages) - lastAssistant - 1
+	if lastAssistant <= 0 || newMessages == 0 {
+		return nil
+	}
+
+	key, err := sessionKey(apiKeyId, modelInfo.Id, openAIReq.Messages[:lastAssistant+1])
+	if err != nil {
+		logger.Errorf(ctx, "session.Key err: %v", err)
+		return nil
+	}
+	entry, ok := session.Take(key)
+	if !ok {
+		return nil
+	}
+	return &upstreamSession{Entry: entry, NewMessages: newMessages}
+}
+
+// storeSession 记录本次对话的完整消息列表(裁剪前)加上回复所对应的账号与上游会话,
+// reply 为上游返回的原始文本,思考内容不计入回复
+func storeSession(ctx context.Context, apiKeyId string, modelInfo common.ModelInfo, messages []model.OpenAIChatMessage, reply, cookie, sessionId string) {
+	if !session.Enabled() || sessionId == "" {
+		return
+	}
+	thinkParser := newThinkParser(modelInfo)
+	_, content := splitThink(thinkParser, reply)
+	_, rest := flushThink(thinkParser)
+	key, err := sessionKey(apiKeyId, modelInfo.Id, append(messages[:len(messages):len(messages)], model.OpenAIChatMessage{
+		Role:    "assistant",
+		Content: content + rest,
+	}))
+	if err != nil {
+		logger.Errorf(ctx, "session.Key err: %v", err)
+		return
+	}
+	session.Put(key, cookie, sessionId)
+}
+
+// sessionKey 计算消息列表的缓存键。只含文本的内容块列表按拼接后的文本计算,
+// 与回复的纯文本一致,客户端以内容块形式回传回复时同样可以命中
+func sessionKey(apiKeyId, modelName string, messages []model.OpenAIChatMessage) (string, error) {
+	normalized := make([]model.OpenAIChatMessage, len(messages))
+	for i, msg := range messages {
+		normalized[i] = msg
+		if text, ok := textContent(msg.Content); ok {
+			normalized[i].Content = text
+		}
+	}
+	return session.Key(apiKeyId, modelName, normalized)
+}
+
+// textContent 返回只含文本内容块的消息内容拼接后的文本
+func textContent(content interface{}) (string, bool) {
+	parts, ok := content.([]interface{})
+	if !ok {
+		return "", false
+	}
+	var text strings.Builder
+	for _, part := range parts {
+		partMap, ok := part.(map[string]interface{})
+		if !ok || partMap["type"] != "text" {
+			return "", false
+		}
+		partText, _ := partMap["text"].(string)
+		text.WriteString(partText)
+	}
+	return text.String(), true
+}
@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"getbind2api/common/config"
+	"getbind2api/getbind-api/mock"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// enableSessionCache 开启会话缓存,测试结束后恢复
+func enableSessionCache(t *testing.T) {
+	t.Helper()
+	saved := config.SessionCacheTTL
+	config.SessionCacheTTL = 60
+	t.Cleanup(func() { config.SessionCacheTTL = saved })
+}
+
+// sendTurn 发送一轮对话并返回回复与上游收到的请求
+func sendTurn(t *testing.T, srv *mock.Server, baseUrl string, req chatRequest) (string, mock.Request) {
+	t.Helper()
+	status, body := doChat(t, baseUrl, req)
+	if status != http.StatusOK {
+		t.Fatalf("status = %d, body: %s", status, body)
+	}
+	_, text, _ := chatReply(t, req, body)
+	requests := srv.Requests()
+	return text, requests[len(requests)-1]
+}
+
+func TestSessionCacheReuse(t *testing.T) {
+	enableSessionCache(t)
+	for _, variant := range chatVariants {
+		t.Run(variant.name, func(t *testing.T) {
+			srv := newMockUpstream(t)
+			baseUrl := newTestServer(t)
+			useCookies(t, newCookie("plain"))
+
+			req := chatRequest{
+				endpoint: variant.endpoint,
+				model:    "claude-3-7-sonnet",
+				stream:   variant.stream,
+				apiKey:   "sk-session-" + variant.name,
+				messages: []testMessage{{Role: "user", Content: "first question"}},
+			}
+			reply, first := sendTurn(t, srv, baseUrl, req)
+
+			req.messages = append(req.messages, testMessage{Role: "assistant", Content: reply}, testMessage{Role: "user", Content: "second question"})
+			_, second := sendTurn(t, srv, baseUrl, req)
+			if second.SessionId != first.SessionId {
+				t.Errorf("session_id = %s, want reused %s", second.SessionId, first.SessionId)
+			}
+			if strings.Contains(second.Query, "first question") || !strings.Contains(second.Query, "second question") {
+				t.Errorf("query = %s, want only the new message", second.Query)
+			}
+		})
+	}
+}
+
+func TestSessionCacheMiss(t *testing.T) {
+	enableSessionCache(t)
+
+	tests := []struct {
+		name string
+		// second 由第一轮的回复构造第二轮请求的API-KEY与消息列表
+		second func(reply string) (string, []testMessage)
+	}{
+		{
+			name: "other api key",
+			second: func(reply string) (string, []testMessage) {
+				return "sk-session-other", []testMessage{
+					{Role: "user", Content: "first question"},
+					{Role: "assistant", Content: reply},
+					{Role: "user", Content: "second question"},
+				}
+			},
+		},
+		{
+			name: "edited reply",
+			second: func(reply string) (string, []testMessage) {
+				return "sk-session-owner", []testMessage{
+					{Role: "user", Content: "first question"},
+					{Role: "assistant", Content: reply + " (edited)"},
+					{Role: "user", Content: "second question"},
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newMockUpstream(t)
+			baseUrl := newTestServer(t)
+			useCookies(t, newCookie("plain"))
+
+			req := chatRequest{
+				endpoint: openAIEndpoint,
+				model:    "claude-3-7-sonnet",
+				apiKey:   "sk-session-owner",
+				messages: []testMessage{{Role: "user", Content: "first question"}},
+			}
+			reply, first := sendTurn(t, srv, baseUrl, req)
+
+			req.apiKey, req.messages = tt.second(reply)
+			_, second := sendTurn(t, srv, baseUrl, req)
+			if second.SessionId == first.SessionId {
+				t.Errorf("session %s reused", second.SessionId)
+			}
+			if !strings.Contains(second.Query, "first question") {
+				t.Errorf("query = %s, want the full history", second.Query)
+			}
+		})
+	}
+}
+
+func TestSessionCacheRegenerate(t *testing.T) {
+	enableSessionCache(t)
+	srv := newMockUpstream(t)
+	baseUrl := newTestServer(t)
+	useCookies(t, newCookie("plain"))
+
+	req := chatRequest{
+		endpoint: openAIEndpoint,
+		model:    "claude-3-7-sonnet",
+		messages: []testMessage{{Role: "user", Content: "first question"}},
+	}
+	reply, first := sendTurn(t, srv, baseUrl, req)
+
+	req.messages = append(req.messages, testMessage{Role: "assistant", Content: reply}, testMessage{Role: "user", Content: "second question"})
+	secondReply, second := sendTurn(t, srv, baseUrl, req)
+	if second.SessionId != first.SessionId {
+		t.Fatalf("session_id = %s, want reused %s", second.SessionId, first.SessionId)
+	}
+
+	// 重新生成第二轮回复:上游会话中已有第二轮的消息,不能再复用
+	_, regenerated := sendTurn(t, srv, baseUrl, req)
+	if regenerated.SessionId == first.SessionId || !strings.Contains(regenerated.Query, "first question") {
+		t.Errorf("regenerated request reused session %s, query = %s", regenerated.SessionId, regenerated.Query)
+	}
+
+	// 重新生成的回复所在的会话可以继续复用
+	messages := append(req.messages, testMessage{Role: "assistant", Content: secondReply}, testMessage{Role: "user", Content: "third question"})
+	req.messages = messages
+	_, third := sendTurn(t, srv, baseUrl, req)
+	if third.SessionId != regenerated.SessionId {
+		t.Errorf("session_id = %s, want %s", third.SessionId, regenerated.SessionId)
+	}
+	if strings.Contains(third.Query, "second question") {
+		t.Errorf("query = %s, want only the new message", third.Query)
+	}
+}
@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"getbind2api/common"
+	"strings"
+)
+
+const (
+	thinkStartTag = "<think>"
+	thinkEndTag   = "</think>"
+)
+
+// thinkParser 从上游文本流中分离开头的 <think>...</think> 思考段,标签可能被拆分在多个数据块中
+type thinkParser struct {
+	thinkStartType bool   // 已进入思考段
+	thinkEndType   bool   // 思考段已结束(或不存在思考段)
+	pending        string // 可能是标签前缀、需要等待后续数据的文本
+}
+
+// newThinkParser 仅对支持 thinking 的模型解析思考段,以模型的 capabilities.thinking 为准,
+// -thinking 后缀作为后备
+func newThinkParser(modelInfo common.ModelInfo) *thinkParser {
+	if !modelInfo.Capabilities.Thinking && !strings.HasSuffix(modelInfo.Id, "-thinking") {
+		return nil
+	}
+	return &thinkParser{}
+}
+
+// Feed 写入增量文本,返回其中的思考内容和正文内容
+func (p *thinkParser) Feed(data string) (reasoning string, content string) {
+	text := p.pending + data
+	p.pending = ""
+
+	if !p.thinkStartType && !p.thinkEndType {
+		trimmed := strings.TrimLeft(text, " \t\r\n")
+		switch {
+		case strings.HasPrefix(trimmed, thinkStartTag):
+			p.thinkStartType = true
+			text = strings.TrimLeft(trimmed[len(thinkStartTag):], "\r\n")
+		case strings.HasPrefix(thinkStartTag, trimmed):
+			// 开头可能是被拆分的开始标签
+			p.pending = text
+			return "", ""
+		default:
+			p.thinkEndType = true
+		}
+	}
+
+	if p.thinkEndType {
+		return "", text
+	}
+
+	if idx := strings.Index(text, thinkEndTag); idx != -1 {
+		p.thinkEndType = true
+		return text[:idx], strings.TrimLeft(text[idx+len(thinkEndTag):], "\r\n")
+	}
+
+	// 保留可能是结束标签前缀的尾部
+	for i := len(thinkEndTag) - 1; i > 0; i-- {
+		if strings.HasSuffix(text, thinkEndTag[:i]) {
+			p.pending = text[len(text)-i:]
+			text = text[:len(text)-i]
+			break
+		}
+	}
+	return text, ""
+}
+
+// Flush 返回缓存中剩余的文本
+func (p *thinkParser) Flush() (reasoning string, content string) {
+	pending := p.pending
+	p.pending = ""
+	if p.thinkStartType && !p.thinkEndType {
+		return pending, ""
+	}
+	return "", pending
+}
+
+// splitThink 在 parser 为空时原样返回正文
+func splitThink(parser *thinkParser, data string) (string, string) {
+	if parser == nil {
+		return "", data
+	}
+	return parser.Feed(data)
+}
+
+// flushThink 在 parser 为空时不返回任何内容
+func flushThink(parser *thinkParser) (string, string) {
+	if parser == nil {
+		return "", ""
+	}
+	return parser.Flush()
+}
@@ -0,0 +1,142 @@
+package controller
+
+import (
+	"getbind2api/common"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestThinkParser(t *testing.T) {
+	tests := []struct {
+		name          string
+		chunks        []string
+		wantReasoning string
+		wantContent   string
+	}{
+		{
+			name:          "think segment",
+			chunks:        []string{"<think>", "reasoning", "</think>", "answer"},
+			wantReasoning: "reasoning",
+			wantContent:   "answer",
+		},
+		{
+			name:          "tags split across chunks",
+			chunks:        []string{"  <th", "ink>\nstep 1", " step 2</th", "ink>\n\nanswer"},
+			wantReasoning: "step 1 step 2",
+			wantContent:   "answer",
+		},
+		{
+			name:        "no think segment",
+			chunks:      []string{"plain ", "answer"},
+			wantContent: "plain answer",
+		},
+		{
+			name:        "think tag after content is not parsed",
+			chunks:      []string{"answer <think>x</think>"},
+			wantContent: "answer <think>x</think>",
+		},
+		{
+			name:        "partial start tag that never completes",
+			chunks:      []string{"<th", "is is text"},
+			wantContent: "<this is text",
+		},
+		{
+			name:          "unterminated think segment",
+			chunks:        []string{"<think>still thinking", "</thi"},
+			wantReasoning: "still thinking</thi",
+		},
+		{
+			name:        "only start tag prefix at end of stream",
+			chunks:      []string{"<thi"},
+			wantContent: "<thi",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &thinkParser{}
+			var reasoning, content string
+			for _, chunk := range tt.chunks {
+				r, c := p.Feed(chunk)
+				reasoning += r
+				content += c
+			}
+			r, c := p.Flush()
+			reasoning += r
+			content += c
+			if reasoning != tt.wantReasoning || content != tt.wantContent {
+				t.Errorf("reasoning = %q, content = %q, want %q, %q", reasoning, content, tt.wantReasoning, tt.wantContent)
+			}
+		})
+	}
+}
+
+func TestSplitThinkWithoutParser(t *testing.T) {
+	if reasoning, content := splitThink(nil, "<think>x</think>"); reasoning != "" || content != "<think>x</think>" {
+		t.Errorf("splitThink(nil) = %q, %q", reasoning, content)
+	}
+	if reasoning, content := flushThink(nil); reasoning != "" || content != "" {
+		t.Errorf("flushThink(nil) = %q, %q", reasoning, content)
+	}
+}
+
+func TestThinkingCapability(t *testing.T) {
+	// 两个模型使用同一个上游思考模型,只有开启 capabilities.thinking 的模型会分离思考内容
+	configPath := filepath.Join(t.TempDir(), "models.yaml")
+	modelConfig := `models:
+  reasoner:
+    model: claude-3.7-sonnet-et
+    max_tokens: 200000
+    capabilities:
+      thinking: true
+  raw-reasoner:
+    model: claude-3.7-sonnet-et
+    max_tokens: 200000
+`
+	if err := os.WriteFile(configPath, []byte(modelConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	common.ModelConfigPath = configPath
+	if err := common.LoadModelRegistry(); err != nil {
+		t.Fatalf("LoadModelRegistry: %v", err)
+	}
+	t.Cleanup(func() {
+		common.ModelConfigPath = ""
+		_ = common.LoadModelRegistry()
+	})
+
+	tests := []struct {
+		model         string
+		wantReasoning string
+		wantText      string
+	}{
+		{"reasoner", "Mock thinking.", "Mock reply:\nhi\n"},
+		{"raw-reasoner", "", "<think>Mock thinking.</think>\nMock reply:\nhi\n"},
+	}
+	for _, tt := range tests {
+		for _, variant := range chatVariants {
+			t.Run(tt.model+"/"+variant.name, func(t *testing.T) {
+				newMockUpstream(t)
+				baseUrl := newTestServer(t)
+				useCookies(t, newCookie("plain"))
+
+				req := chatRequest{
+					endpoint: variant.endpoint,
+					model:    tt.model,
+					stream:   variant.stream,
+					messages: []testMessage{{Role: "user", Content: "hi"}},
+				}
+				status, body := doChat(t, baseUrl, req)
+				if status != http.StatusOK {
+					t.Fatalf("status = %d, body: %s", status, body)
+				}
+				reasoning, text, _ := chatReply(t, req, body)
+				if reasoning != tt.wantReasoning || text != tt.wantText {
+					t.Errorf("reasoning = %q, text = %q, want %q, %q", reasoning, text, tt.wantReasoning, tt.wantText)
+				}
+			})
+		}
+	}
+}
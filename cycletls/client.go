@@ -12,6 +12,7 @@ type Browser struct {
 	// Return a greeting that embeds the name in a message.
 	JA3                string
 	UserAgent          string
+	HTTP2              string
 	Cookies            []Cookie
 	InsecureSkipVerify bool
 	forceHTTP1         bool
@@ -21,13 +22,13 @@ var disabledRedirect = func(req *http.Request, via []*http.Request) error {
 	return http.ErrUseLastResponse
 }
 
-func clientBuilder(browser Browser, dialer proxy.ContextDialer, timeout int, disableRedirect bool) http.Client {
+func clientBuilder(transport http.RoundTripper, timeout int, disableRedirect bool) http.Client {
 	//if timeout is not set in call default to 15
 	if timeout == 0 {
 		timeout = 15
 	}
 	client := http.Client{
-		Transport: newRoundTripper(browser, dialer),
+		Transport: transport,
 		Timeout:   time.Duration(timeout) * time.Second,
 	}
 	//if disableRedirect is set to true httpclient will not redirect
@@ -71,21 +72,14 @@ func NewTransportWithProxy(ja3 string, useragent string, proxy proxy.ContextDial
 	}, proxy)
 }
 
-// newClient creates a new http client
-func newClient(browser Browser, timeout int, disableRedirect bool, UserAgent string, proxyURL ...string) (http.Client, error) {
-	var dialer proxy.ContextDialer
-	if len(proxyURL) > 0 && len(proxyURL[0]) > 0 {
-		var err error
-		dialer, err = newConnectDialer(proxyURL[0], UserAgent)
-		if err != nil {
-			return http.Client{
-				Timeout:       time.Duration(timeout) * time.Second,
-				CheckRedirect: disabledRedirect,
-			}, err
-		}
-	} else {
-		dialer = proxy.Direct
+// newClient creates a new http client,底层连接从共享的连接池中复用
+func newClient(browser Browser, timeout int, disableRedirect bool, proxyURL string) (http.Client, error) {
+	transport, err := getPooledTransport(browser, proxyURL)
+	if err != nil {
+		return http.Client{
+			Timeout:       time.Duration(timeout) * time.Second,
+			CheckRedirect: disabledRedirect,
+		}, err
 	}
-
-	return clientBuilder(browser, dialer, timeout, disableRedirect), nil
+	return clientBuilder(transport, timeout, disableRedirect), nil
 }
@@ -2,6 +2,7 @@ package cycletls
 
 import (
 	"bufio"
+	"context"
 	"encoding/json"
 	"flag"
 	"fmt"
@@ -14,7 +15,6 @@ import (
 	"os"
 	"runtime"
 	"strings"
-	"time"
 )
 
 // Options sets CycleTLS client options
@@ -25,6 +25,7 @@ type Options struct {
 	Body               string            `json:"body"`
 	Ja3                string            `json:"ja3"`
 	UserAgent          string            `json:"userAgent"`
+	HTTP2              string            `json:"http2"` // Akamai 格式的 HTTP/2 指纹,为空时按 User-Agent 推断
 	Proxy              string            `json:"proxy"`
 	Cookies            []Cookie          `json:"cookies"`
 	Timeout            int               `json:"timeout"`
@@ -55,6 +56,7 @@ type Response struct {
 	Headers   map[string]string
 	Cookies   []*nhttp.Cookie
 	FinalUrl  string
+	ConnError bool // 未收到上游响应(连接、代理或TLS握手失败)
 }
 
 // JSONBody converts response body to json
@@ -78,6 +80,7 @@ func processRequest(request cycleTLSRequest) (result fullRequest) {
 	var browser = Browser{
 		JA3:                request.Options.Ja3,
 		UserAgent:          request.Options.UserAgent,
+		HTTP2:              request.Options.HTTP2,
 		Cookies:            request.Options.Cookies,
 		InsecureSkipVerify: request.Options.InsecureSkipVerify,
 		forceHTTP1:         request.Options.ForceHTTP1,
@@ -87,7 +90,6 @@ func processRequest(request cycleTLSRequest) (result fullRequest) {
 		browser,
 		request.Options.Timeout,
 		request.Options.DisableRedirect,
-		request.Options.UserAgent,
 		request.Options.Proxy,
 	)
 	if err != nil {
@@ -152,6 +154,10 @@ func processRequest(request cycleTLSRequest) (result fullRequest) {
 
 	}
 	headerOrder := parseUserAgent(request.Options.UserAgent).HeaderOrder
+	// 指纹无效时建立连接会失败并返回错误,这里沿用 User-Agent 推断的顺序
+	if fingerprint, err := parseHTTP2Fingerprint(request.Options.HTTP2); err == nil && fingerprint != nil {
+		headerOrder = fingerprint.PseudoHeaderOrder
+	}
 
 	//ordering the pseudo headers and our normal headers
 	req.Header = http.Header{
@@ -172,12 +178,12 @@ func processRequest(request cycleTLSRequest) (result fullRequest) {
 	}
 	req.Header.Set("Host", u.Host)
 	req.Header.Set("user-agent", request.Options.UserAgent)
+	addCookies(req, request.Options.Cookies)
 	return fullRequest{req: req, client: client, options: request}
 
 }
 
 func dispatcher(res fullRequest) (response Response, err error) {
-	defer res.client.CloseIdleConnections()
 	finalUrl := res.options.Options.URL
 	resp, err := res.client.Do(res.req)
 	if err != nil {
@@ -186,7 +192,7 @@ func dispatcher(res fullRequest) (response Response, err error) {
 
 		headers := make(map[string]string)
 		var cookies []*nhttp.Cookie
-		return Response{RequestID: res.options.RequestID, Status: parsedError.StatusCode, Body: parsedError.ErrorMsg + "-> \n" + string(err.Error()), Headers: headers, Cookies: cookies, FinalUrl: finalUrl}, nil //normally return error here
+		return Response{RequestID: res.options.RequestID, Status: parsedError.StatusCode, Body: parsedError.ErrorMsg + "-> \n" + string(err.Error()), Headers: headers, Cookies: cookies, FinalUrl: finalUrl, ConnError: true}, nil //normally return error here
 
 	}
 	defer resp.Body.Close()
@@ -240,20 +246,20 @@ func (client CycleTLS) Queue(URL string, options Options, Method string) {
 
 // Do creates a single request
 func (client CycleTLS) Do(URL string, options Options, Method string) (response Response, err error) {
+	return client.DoWithContext(context.Background(), URL, options, Method)
+}
+
+// DoWithContext 与 Do 相同, ctx 取消时中断请求
+func (client CycleTLS) DoWithContext(ctx context.Context, URL string, options Options, Method string) (response Response, err error) {
 
 	options.URL = URL
 	options.Method = Method
 	// Set default values if not provided
-	if options.Ja3 == "" {
-		options.Ja3 = "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,18-35-65281-45-17513-27-65037-16-10-11-5-13-0-43-23-51,29-23-24,0"
-	}
-	if options.UserAgent == "" {
-		// Mac OS Chrome 121
-		options.UserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"
-	}
+	applyDefaultProfile(&options)
 	opt := cycleTLSRequest{"cycleTLSRequest", options}
 
 	res := processRequest(opt)
+	res.req = res.req.WithContext(ctx)
 	response, err = dispatcher(res)
 	if err != nil {
 		return response, err
@@ -408,210 +414,59 @@ func main() {
 	log.Fatal(nhttp.ListenAndServe(*addr, nil))
 }
 
-// 修改 SSEResponse 结构体，添加 FinalUrl 字段
+// SSEResponse 上游返回的一个事件,Done 为 true 时表示流结束或请求失败
 type SSEResponse struct {
 	RequestID string
 	Status    int
-	Data      string
+	Event     string // event-stream 中的事件类型
+	Id        string // event-stream 中的事件ID
+	Retry     int    // event-stream 中的重连间隔(毫秒),未指定时为-1
+	Data      string // 每个 data 行保留末尾的换行符,与逐行读取时传给上层的文本一致
 	Done      bool
-	FinalUrl  string // 添加 FinalUrl 字段
+	FinalUrl  string
+	ConnError bool // 未收到上游响应(连接、代理或TLS握手失败)
 }
 
-// 修改 dispatcher 函数以支持 SSE
-//func dispatcherSSE(res fullRequest, sseChan chan<- SSEResponse) {
-//	defer res.client.CloseIdleConnections()
-//	finalUrl := res.options.Options.URL
-//
-//	resp, err := res.client.Do(res.req)
-//	if err != nil {
-//		parsedError := parseError(err)
-//		sseChan <- SSEResponse{
-//			RequestID: res.options.RequestID,
-//			Status:    parsedError.StatusCode,
-//			Data:      parsedError.ErrorMsg + "-> \n" + string(err.Error()),
-//			Done:      true,
-//			FinalUrl:  finalUrl,
-//		}
-//		return
-//	}
-//	defer resp.Body.Close()
-//
-//	if resp != nil && resp.Request != nil && resp.Request.URL != nil {
-//		finalUrl = resp.Request.URL.String()
-//	}
-//
-//	scanner := bufio.NewScanner(resp.Body)
-//	// 自定义分割函数，处理SSE格式
-//	scanner.Split(func(data []byte, atEOF bool) (advance int, token []byte, err error) {
-//		if atEOF && len(data) == 0 {
-//			return 0, nil, nil
-//		}
-//
-//		// 查找 "data: " 前缀
-//		if i := bytes.Index(data, []byte("data: ")); i >= 0 {
-//			// 查找下一个 "data: " 或结束
-//			nextI := bytes.Index(data[i+6:], []byte("data: "))
-//			if nextI >= 0 {
-//				return i + 6 + nextI, data[i : i+6+nextI], nil
-//			}
-//			// 如果是最后一块数据
-//			if atEOF {
-//				return len(data), data[i:], nil
-//			}
-//		}
-//
-//		// 如果需要更多数据
-//		if !atEOF {
-//			return 0, nil, nil
-//		}
-//
-//		// 处理剩余数据
-//		return len(data), data, nil
-//	})
-//
-//	for scanner.Scan() {
-//		text := scanner.Text()
-//		if strings.TrimSpace(text) != "" {
-//			sseChan <- SSEResponse{
-//				RequestID: res.options.RequestID,
-//				Status:    resp.StatusCode,
-//				Data:      text,
-//				Done:      false,
-//				FinalUrl:  finalUrl,
-//			}
-//		}
-//	}
-//
-//	if err := scanner.Err(); err != nil {
-//		sseChan <- SSEResponse{
-//			RequestID: res.options.RequestID,
-//			Status:    resp.StatusCode,
-//			Data:      "Error reading stream: " + err.Error(),
-//			Done:      true,
-//			FinalUrl:  finalUrl,
-//		}
-//		return
-//	}
-//
-//	sseChan <- SSEResponse{
-//		RequestID: res.options.RequestID,
-//		Status:    resp.StatusCode,
-//		Data:      "",
-//		Done:      true,
-//		FinalUrl:  finalUrl,
-//	}
-//}
-
-//func dispatcherSSE(res fullRequest, sseChan chan<- SSEResponse) {
-//	defer res.client.CloseIdleConnections()
-//	finalUrl := res.options.Options.URL
-//
-//	resp, err := res.client.Do(res.req)
-//	if err != nil {
-//		parsedError := parseError(err)
-//		sseChan <- SSEResponse{
-//			RequestID: res.options.RequestID,
-//			Status:    parsedError.StatusCode,
-//			Data:      parsedError.ErrorMsg + "-> \n" + string(err.Error()),
-//			Done:      true,
-//			FinalUrl:  finalUrl,
-//		}
-//		return
-//	}
-//	defer resp.Body.Close()
-//
-//	if resp != nil && resp.Request != nil && resp.Request.URL != nil {
-//		finalUrl = resp.Request.URL.String()
-//	}
-//
-//	reader := bufio.NewReader(resp.Body)
-//	var buf bytes.Buffer
-//
-//	const maxRetries = 3
-//	retries := 0
-//
-//	for {
-//		// 读取直到"data: "
-//		line, err := reader.ReadString('\n')
-//		if err != nil {
-//			if err == io.EOF {
-//				break
-//			}
-//
-//			if retries < maxRetries {
-//				retries++
-//				time.Sleep(time.Second * time.Duration(retries))
-//				continue
-//			}
-//
-//			sseChan <- SSEResponse{
-//				RequestID: res.options.RequestID,
-//				Status:    resp.StatusCode,
-//				Data:      "Error reading stream: " + err.Error(),
-//				Done:      true,
-//				FinalUrl:  finalUrl,
-//			}
-//			return
-//		}
-//
-//		// 重置重试计数
-//		retries = 0
-//
-//		// 处理数据
-//		if strings.HasPrefix(line, "data: ") {
-//			// 清空buffer
-//			buf.Reset()
-//
-//			// 写入新数据（去掉"data: "前缀）
-//			data := strings.TrimPrefix(line, "data: ")
-//			data = strings.TrimSpace(data)
-//
-//			if data != "" {
-//				sseChan <- SSEResponse{
-//					RequestID: res.options.RequestID,
-//					Status:    resp.StatusCode,
-//					Data:      data,
-//					Done:      false,
-//					FinalUrl:  finalUrl,
-//				}
-//			}
-//		}
-//
-//		// 可选：检查是否有结束标记
-//		if strings.Contains(line, "[DONE]") {
-//			break
-//		}
-//	}
-//
-//	// 发送完成信号
-//	sseChan <- SSEResponse{
-//		RequestID: res.options.RequestID,
-//		Status:    resp.StatusCode,
-//		Data:      "",
-//		Done:      true,
-//		FinalUrl:  finalUrl,
-//	}
-//}
-
+// dispatcherSSE 发起请求并推送上游返回的数据。
+// text/event-stream 响应按事件解析,其他响应按行推送并去掉 "data: " 前缀,两者的数据行均保留换行符
 func dispatcherSSE(res fullRequest, sseChan chan<- SSEResponse) {
-	defer res.client.CloseIdleConnections()
-
+	ctx := res.req.Context()
 	finalUrl := res.options.Options.URL
 
+	// send 在调用方取消请求后不再阻塞发送
+	send := func(response SSEResponse) bool {
+		select {
+		case sseChan <- response:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+
 	resp, err := res.client.Do(res.req)
 	if err != nil {
+		if ctx.Err() != nil {
+			return
+		}
 		parsedError := parseError(err)
-		sseChan <- SSEResponse{
+		send(SSEResponse{
 			RequestID: res.options.RequestID,
 			Status:    parsedError.StatusCode,
 			Data:      fmt.Sprintf("%s-> \n%s", parsedError.ErrorMsg, err.Error()),
 			Done:      true,
 			FinalUrl:  finalUrl,
-		}
+			ConnError: true,
+		})
 		return
 	}
 	defer resp.Body.Close()
 
+	// 调用方取消请求时关闭上游响应体,中断阻塞中的读取
+	stop := context.AfterFunc(ctx, func() {
+		resp.Body.Close()
+	})
+	defer stop()
+
 	// 检查HTTP状态码，非2xx状态码可能表示错误
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		bodyBytes, _ := io.ReadAll(resp.Body)
@@ -620,13 +475,13 @@ func dispatcherSSE(res fullRequest, sseChan chan<- SSEResponse) {
 			errorMsg = fmt.Sprintf("HTTP error status: %d", resp.StatusCode)
 		}
 
-		sseChan <- SSEResponse{
+		send(SSEResponse{
 			RequestID: res.options.RequestID,
 			Status:    resp.StatusCode,
 			Data:      errorMsg,
 			Done:      true,
 			FinalUrl:  finalUrl,
-		}
+		})
 		return
 	}
 
@@ -635,107 +490,89 @@ func dispatcherSSE(res fullRequest, sseChan chan<- SSEResponse) {
 		finalUrl = resp.Request.URL.String()
 	}
 
-	reader := bufio.NewReader(resp.Body)
-	const maxRetries = 3
-	retries := 0
-
-	for {
-		// 读取直到换行符
-		line, err := reader.ReadString('\n')
-		if err != nil {
-			if err == io.EOF {
-				sseChan <- SSEResponse{
-					RequestID: res.options.RequestID,
-					Status:    resp.StatusCode,
-					Data:      line, // 保留原始格式
-					Done:      false,
-					FinalUrl:  finalUrl,
-				}
-
-				sseChan <- SSEResponse{
-					RequestID: res.options.RequestID,
-					Status:    resp.StatusCode,
-					Data:      "[DONE]",
-					Done:      true,
-					FinalUrl:  finalUrl,
-				}
+	var readErr error
+	if isEventStream(resp.Header.Get("Content-Type")) {
+		decoder := NewSSEDecoder(resp.Body)
+		for {
+			event, err := decoder.Next()
+			if err != nil {
+				readErr = err
 				break
 			}
-
-			if retries < maxRetries {
-				retries++
-				time.Sleep(time.Second * time.Duration(retries))
-				continue
-			}
-
-			sseChan <- SSEResponse{
+			if !send(SSEResponse{
 				RequestID: res.options.RequestID,
 				Status:    resp.StatusCode,
-				Data:      "Error reading stream: " + err.Error(),
-				Done:      true,
+				Event:     event.Event,
+				Id:        event.Id,
+				Retry:     event.Retry,
+				Data:      event.Data + "\n",
 				FinalUrl:  finalUrl,
+			}) {
+				return
 			}
-			return
 		}
-
-		// 重置重试计数
-		retries = 0
-
-		// 处理数据行 - 不要去除空白字符，保留原始格式
-		if strings.HasPrefix(line, "data: ") {
-			// 只移除前缀"data: "，但保留其他所有字符，包括换行符
-			data := strings.TrimPrefix(line, "data: ")
-			if data != "" {
-				sseChan <- SSEResponse{
-					RequestID: res.options.RequestID,
-					Status:    resp.StatusCode,
-					Data:      data, // 保留原始格式，包括换行符和空格
-					Done:      false,
-					FinalUrl:  finalUrl,
-				}
-			}
-		} else if line != "" {
-			// 处理不带"data: "前缀的非空行
-			sseChan <- SSEResponse{
+	} else {
+		reader := bufio.NewReader(resp.Body)
+		for {
+			line, err := reader.ReadString('\n')
+			line = strings.TrimPrefix(line, "data: ")
+			if line != "" && !send(SSEResponse{
 				RequestID: res.options.RequestID,
 				Status:    resp.StatusCode,
-				Data:      line, // 保留原始格式
-				Done:      false,
+				Retry:     -1,
+				Data:      line,
 				FinalUrl:  finalUrl,
+			}) {
+				return
+			}
+			if err != nil {
+				readErr = err
+				break
 			}
 		}
+	}
 
-		// 检查是否有结束标记
-		//if strings.Contains(line, "[DONE]") {
-		//	break
-		//}
+	if ctx.Err() != nil {
+		return
+	}
+	if readErr != io.EOF {
+		send(SSEResponse{
+			RequestID: res.options.RequestID,
+			Status:    resp.StatusCode,
+			Data:      "Error reading stream: " + readErr.Error(),
+			Done:      true,
+			FinalUrl:  finalUrl,
+		})
+		return
 	}
 
 	// 发送完成信号
-	sseChan <- SSEResponse{
+	send(SSEResponse{
 		RequestID: res.options.RequestID,
 		Status:    resp.StatusCode,
 		Data:      "[DONE]",
 		Done:      true,
 		FinalUrl:  finalUrl,
-	}
+	})
+}
+
+// isEventStream 判断响应是否为 text/event-stream
+func isEventStream(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return strings.EqualFold(strings.TrimSpace(mediaType), "text/event-stream")
 }
 
-// 修改 Do 方法以支持 SSE
-func (client CycleTLS) DoSSE(URL string, options Options, Method string) (<-chan SSEResponse, error) {
+// 修改 Do 方法以支持 SSE, ctx 取消时关闭上游连接并结束数据推送
+func (client CycleTLS) DoSSE(ctx context.Context, URL string, options Options, Method string) (<-chan SSEResponse, error) {
 	sseChan := make(chan SSEResponse)
 
 	options.URL = URL
 	options.Method = Method
-	if options.Ja3 == "" {
-		options.Ja3 = "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,18-35-65281-45-17513-27-65037-16-10-11-5-13-0-43-23-51,29-23-24,0"
-	}
-	if options.UserAgent == "" {
-		options.UserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/121.0.0.0 Safari/537.36"
-	}
+	applyDefaultProfile(&options)
 
 	opt := cycleTLSRequest{"cycleTLSRequest", options}
 	res := processRequest(opt)
+	res.req = res.req.WithContext(ctx)
 
 	go func() {
 		defer close(sseChan)
@@ -0,0 +1,52 @@
+package cycletls
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestDoSSEKeepsLineNewlines(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        []string
+	}{
+		{
+			name:        "event stream",
+			contentType: "text/event-stream",
+			body:        "data: Mock reply:\n\ndata: a\ndata: b\n\n",
+			want:        []string{"Mock reply:\n", "a\nb\n", "[DONE]"},
+		},
+		{
+			name:        "plain",
+			contentType: "text/plain",
+			body:        "data: Mock reply:\nhello\n",
+			want:        []string{"Mock reply:\n", "hello\n", "[DONE]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", tt.contentType)
+				w.Write([]byte(tt.body))
+			}))
+			defer ts.Close()
+
+			sseChan, err := Init().DoSSE(context.Background(), ts.URL, Options{}, "POST")
+			if err != nil {
+				t.Fatalf("DoSSE err: %v", err)
+			}
+			var got []string
+			for response := range sseChan {
+				got = append(got, response.Data)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("data = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
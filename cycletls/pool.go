@@ -0,0 +1,116 @@
+package cycletls
+
+import (
+	"sync"
+	"time"
+
+	http "github.com/Danny-Dasilva/fhttp"
+	"golang.org/x/net/proxy"
+)
+
+// transportKey 相同指纹、代理与TLS选项的请求共享同一个 roundTripper,从而复用上游连接
+type transportKey struct {
+	ja3                string
+	userAgent          string
+	http2              string
+	proxy              string
+	insecureSkipVerify bool
+	forceHTTP1         bool
+}
+
+const (
+	maxPooledTransports = 64               // 连接池中 roundTripper 数量上限,超出时淘汰最久未使用的
+	transportIdleTTL    = 10 * time.Minute // 超过该时长未使用的 roundTripper 会被淘汰
+)
+
+type pooledTransport struct {
+	rt       *roundTripper
+	lastUsed time.Time
+}
+
+var (
+	transportPool   = map[transportKey]*pooledTransport{}
+	transportPoolMu sync.Mutex
+)
+
+// getPooledTransport 返回共享的 roundTripper,不存在时创建。cookie 按请求设置,不绑定在连接上
+func getPooledTransport(browser Browser, proxyURL string) (http.RoundTripper, error) {
+	key := transportKey{
+		ja3:                browser.JA3,
+		userAgent:          browser.UserAgent,
+		http2:              browser.HTTP2,
+		proxy:              proxyURL,
+		insecureSkipVerify: browser.InsecureSkipVerify,
+		forceHTTP1:         browser.forceHTTP1,
+	}
+
+	now := time.Now()
+	transportPoolMu.Lock()
+	evicted := evictTransportsLocked(now, key)
+	entry, ok := transportPool[key]
+	if !ok {
+		var dialer proxy.ContextDialer = proxy.Direct
+		if proxyURL != "" {
+			var err error
+			dialer, err = newConnectDialer(proxyURL, browser.UserAgent)
+			if err != nil {
+				transportPoolMu.Unlock()
+				closeTransports(evicted)
+				return nil, err
+			}
+		}
+		browser.Cookies = nil
+		entry = &pooledTransport{rt: newRoundTripper(browser, dialer).(*roundTripper)}
+		transportPool[key] = entry
+	}
+	entry.lastUsed = now
+	transportPoolMu.Unlock()
+
+	closeTransports(evicted)
+	return entry.rt, nil
+}
+
+// evictTransportsLocked 从连接池中移除超过 transportIdleTTL 未使用的 roundTripper,
+// 并在需要为 key 新建时按最久未使用淘汰,保证数量不超过 maxPooledTransports。调用方需持有 transportPoolMu
+func evictTransportsLocked(now time.Time, key transportKey) []*roundTripper {
+	var evicted []*roundTripper
+	for k, entry := range transportPool {
+		if k != key && now.Sub(entry.lastUsed) > transportIdleTTL {
+			evicted = append(evicted, entry.rt)
+			delete(transportPool, k)
+		}
+	}
+	if _, ok := transportPool[key]; ok {
+		return evicted
+	}
+	for len(transportPool) >= maxPooledTransports {
+		var oldestKey transportKey
+		var oldest *pooledTransport
+		for k, entry := range transportPool {
+			if oldest == nil || entry.lastUsed.Before(oldest.lastUsed) {
+				oldestKey, oldest = k, entry
+			}
+		}
+		evicted = append(evicted, oldest.rt)
+		delete(transportPool, oldestKey)
+	}
+	return evicted
+}
+
+// closeTransports 关闭被淘汰的 roundTripper 的空闲连接。进行中的请求不受影响,
+// HTTP/2 连接没有空闲超时,因此在 idleConnTimeout 后再关闭一次请求结束后空闲下来的连接
+func closeTransports(transports []*roundTripper) {
+	for _, rt := range transports {
+		rt.CloseIdleConnections()
+		time.AfterFunc(idleConnTimeout, rt.CloseIdleConnections)
+	}
+}
+
+// CloseIdleConnections 关闭连接池中所有空闲的上游连接
+func CloseIdleConnections() {
+	transportPoolMu.Lock()
+	defer transportPoolMu.Unlock()
+	for _, entry := range transportPool {
+		entry.rt.CloseIdleConnections()
+	}
+}
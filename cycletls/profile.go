@@ -0,0 +1,220 @@
+package cycletls
+
+import (
+	"math/rand"
+	"sort"
+	"strings"
+)
+
+// Profile 浏览器指纹。JA3、HTTP/2 指纹、User-Agent、客户端提示请求头与请求头顺序需来自同一浏览器的同一版本,
+// 混用会被上游的风控识别
+type Profile struct {
+	Name        string
+	JA3         string
+	HTTP2       string // Akamai 格式的 HTTP/2 指纹,见 parseHTTP2Fingerprint
+	UserAgent   string
+	Headers     map[string]string // sec-ch-ua 等客户端提示请求头,Firefox/Safari 不发送
+	HeaderOrder []string
+}
+
+// DefaultProfile 未指定指纹时使用的浏览器指纹
+const DefaultProfile = "chrome_135"
+
+// 各浏览器版本的 JA3。Chrome 131 起支持 X25519MLKEM768(4588),Chrome 133 起 ALPS 扩展号由 17513 改为 17613;
+// Firefox 132 起支持 X25519MLKEM768
+const (
+	chrome131JA3  = "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,18-35-65281-45-17513-27-65037-16-10-11-5-13-0-43-23-51,4588-29-23-24,0"
+	chrome135JA3  = "771,4865-4866-4867-49195-49199-49196-49200-52393-52392-49171-49172-156-157-47-53,18-35-65281-45-17613-27-65037-16-10-11-5-13-0-43-23-51,4588-29-23-24,0"
+	firefox128JA3 = "771,4865-4867-4866-49195-49199-52393-52392-49196-49200-49162-49161-49171-49172-156-157-47-53,0-23-65281-10-11-35-16-5-34-51-43-13-45-28-27-65037,29-23-24-25-256-257,0"
+	firefox136JA3 = "771,4865-4867-4866-49195-49199-52393-52392-49196-49200-49162-49161-49171-49172-156-157-47-53,0-23-65281-10-11-35-16-5-34-51-43-13-45-28-27-65037,4588-29-23-24-25-256-257,0"
+	safariJA3     = "771,4865-4866-4867-49196-49195-52393-49200-49199-52392-49162-49161-49172-49171-157-156-53-47-49160-49170-10,0-23-65281-10-11-16-5-13-18-51-45-43-27-21,29-23-24-25,0"
+)
+
+// 各浏览器的 HTTP/2 指纹:SETTINGS、WINDOW_UPDATE、PRIORITY 帧与伪头部顺序
+const (
+	chromeHTTP2   = "1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p"
+	firefoxHTTP2  = "1:65536;2:0;4:131072;5:16384|12517377|0|m,p,a,s"
+	safari17HTTP2 = "2:0;4:4194304;3:100|10485760|0|m,s,p,a"
+	safari18HTTP2 = "2:0;3:100;4:2097152;9:1|10420225|0|m,s,a,p"
+)
+
+// 各浏览器 fetch 请求的请求头顺序
+var (
+	chromeHeaderOrder = []string{
+		"content-length",
+		"sec-ch-ua-platform",
+		"user-agent",
+		"sec-ch-ua",
+		"content-type",
+		"sec-ch-ua-mobile",
+		"accept",
+		"origin",
+		"sec-fetch-site",
+		"sec-fetch-mode",
+		"sec-fetch-dest",
+		"referer",
+		"accept-encoding",
+		"accept-language",
+		"cookie",
+		"priority",
+	}
+	firefoxHeaderOrder = []string{
+		"user-agent",
+		"accept",
+		"accept-language",
+		"accept-encoding",
+		"content-type",
+		"content-length",
+		"origin",
+		"referer",
+		"cookie",
+		"sec-fetch-dest",
+		"sec-fetch-mode",
+		"sec-fetch-site",
+		"priority",
+		"te",
+	}
+	safariHeaderOrder = []string{
+		"content-type",
+		"accept",
+		"sec-fetch-site",
+		"origin",
+		"sec-fetch-mode",
+		"user-agent",
+		"referer",
+		"content-length",
+		"sec-fetch-dest",
+		"accept-language",
+		"priority",
+		"accept-encoding",
+		"cookie",
+	}
+)
+
+// clientHintHeaders 由指纹决定的请求头,应用指纹时先移除请求中已有的值
+var clientHintHeaders = []string{"user-agent", "sec-ch-ua", "sec-ch-ua-mobile", "sec-ch-ua-platform", "priority"}
+
+var profiles = map[string]Profile{
+	"chrome_131": chromiumProfile("chrome_131", chrome131JA3, "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36",
+		`"Google Chrome";v="131", "Chromium";v="131", "Not_A Brand";v="24"`, "macOS"),
+	"chrome_135": chromiumProfile("chrome_135", chrome135JA3, "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/135.0.0.0 Safari/537.36",
+		`"Google Chrome";v="135", "Not-A.Brand";v="8", "Chromium";v="135"`, "macOS"),
+	"chrome_135_windows": chromiumProfile("chrome_135_windows", chrome135JA3, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/135.0.0.0 Safari/537.36",
+		`"Google Chrome";v="135", "Not-A.Brand";v="8", "Chromium";v="135"`, "Windows"),
+	"edge_131": chromiumProfile("edge_131", chrome131JA3, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36 Edg/131.0.0.0",
+		`"Microsoft Edge";v="131", "Chromium";v="131", "Not_A Brand";v="24"`, "Windows"),
+	"edge_135": chromiumProfile("edge_135", chrome135JA3, "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/135.0.0.0 Safari/537.36 Edg/135.0.0.0",
+		`"Microsoft Edge";v="135", "Not-A.Brand";v="8", "Chromium";v="135"`, "Windows"),
+	"firefox_128": {
+		Name:        "firefox_128",
+		JA3:         firefox128JA3,
+		HTTP2:       firefoxHTTP2,
+		UserAgent:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10.15; rv:128.0) Gecko/20100101 Firefox/128.0",
+		Headers:     map[string]string{"priority": "u=4"},
+		HeaderOrder: firefoxHeaderOrder,
+	},
+	"firefox_136": {
+		Name:        "firefox_136",
+		JA3:         firefox136JA3,
+		HTTP2:       firefoxHTTP2,
+		UserAgent:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:136.0) Gecko/20100101 Firefox/136.0",
+		Headers:     map[string]string{"priority": "u=4"},
+		HeaderOrder: firefoxHeaderOrder,
+	},
+	"safari_17": {
+		Name:        "safari_17",
+		JA3:         safariJA3,
+		HTTP2:       safari17HTTP2,
+		UserAgent:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.6 Safari/605.1.15",
+		Headers:     map[string]string{"priority": "u=3, i"},
+		HeaderOrder: safariHeaderOrder,
+	},
+	"safari_18": {
+		Name:        "safari_18",
+		JA3:         safariJA3,
+		HTTP2:       safari18HTTP2,
+		UserAgent:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.3 Safari/605.1.15",
+		Headers:     map[string]string{"priority": "u=3, i"},
+		HeaderOrder: safariHeaderOrder,
+	},
+}
+
+func chromiumProfile(name, ja3, userAgent, secChUa, platform string) Profile {
+	return Profile{
+		Name:      name,
+		JA3:       ja3,
+		HTTP2:     chromeHTTP2,
+		UserAgent: userAgent,
+		Headers: map[string]string{
+			"sec-ch-ua":          secChUa,
+			"sec-ch-ua-mobile":   "?0",
+			"sec-ch-ua-platform": `"` + platform + `"`,
+			"priority":           "u=1, i",
+		},
+		HeaderOrder: chromeHeaderOrder,
+	}
+}
+
+// GetProfile 按名称返回浏览器指纹
+func GetProfile(name string) (Profile, bool) {
+	profile, ok := profiles[strings.ToLower(name)]
+	return profile, ok
+}
+
+// RandomProfile 随机返回一个浏览器指纹
+func RandomProfile() Profile {
+	names := ProfileNames()
+	return profiles[names[rand.Intn(len(names))]]
+}
+
+// ProfileNames 返回所有浏览器指纹的名称
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Apply 将指纹应用到请求选项,替换其中的 User-Agent 与客户端提示请求头
+func (p Profile) Apply(options *Options) {
+	headers := make(map[string]string, len(options.Headers)+len(p.Headers)+1)
+	for k, v := range options.Headers {
+		isClientHint := false
+		for _, h := range clientHintHeaders {
+			if strings.EqualFold(k, h) {
+				isClientHint = true
+				break
+			}
+		}
+		if !isClientHint {
+			headers[k] = v
+		}
+	}
+	for k, v := range p.Headers {
+		headers[k] = v
+	}
+	headers["user-agent"] = p.UserAgent
+
+	options.Headers = headers
+	options.Ja3 = p.JA3
+	options.HTTP2 = p.HTTP2
+	options.UserAgent = p.UserAgent
+	options.HeaderOrder = p.HeaderOrder
+}
+
+// applyDefaultProfile 未指定 JA3 或 User-Agent 时使用默认指纹补全
+func applyDefaultProfile(options *Options) {
+	profile := profiles[DefaultProfile]
+	// 指定了 User-Agent 时 HTTP/2 指纹按 User-Agent 推断,避免与默认指纹的浏览器不一致
+	if options.HTTP2 == "" && options.UserAgent == "" {
+		options.HTTP2 = profile.HTTP2
+	}
+	if options.Ja3 == "" {
+		options.Ja3 = profile.JA3
+	}
+	if options.UserAgent == "" {
+		options.UserAgent = profile.UserAgent
+	}
+}
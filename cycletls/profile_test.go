@@ -0,0 +1,168 @@
+package cycletls
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	http2 "github.com/Danny-Dasilva/fhttp/http2"
+	utls "github.com/refraction-networking/utls"
+)
+
+var browserVersionPattern = regexp.MustCompile(`(Chrome|Firefox|Version)/(\d+)`)
+
+// profileVersion 返回 User-Agent 中的浏览器及主版本号,Safari 取 Version/ 的版本号
+func profileVersion(t *testing.T, profile Profile) (string, int) {
+	var browser string
+	var version int
+	for _, match := range browserVersionPattern.FindAllStringSubmatch(profile.UserAgent, -1) {
+		if browser == "" || match[1] == "Firefox" {
+			browser = match[1]
+			version, _ = strconv.Atoi(match[2])
+		}
+	}
+	if browser == "" {
+		t.Fatalf("%s: no browser version in user agent %q", profile.Name, profile.UserAgent)
+	}
+	return browser, version
+}
+
+func TestProfileJA3MatchesVersion(t *testing.T) {
+	for _, name := range ProfileNames() {
+		profile := profiles[name]
+		t.Run(name, func(t *testing.T) {
+			tokens := strings.Split(profile.JA3, ",")
+			if len(tokens) != 5 {
+				t.Fatalf("invalid ja3 %q", profile.JA3)
+			}
+			extensions := strings.Split(tokens[2], "-")
+			curves := strings.Split(tokens[3], "-")
+			browser, version := profileVersion(t, profile)
+
+			wantMLKEM := false
+			switch browser {
+			case "Chrome":
+				wantMLKEM = version >= 131
+				alps, staleAlps := "17513", "17613"
+				if version >= 133 {
+					alps, staleAlps = staleAlps, alps
+				}
+				if !slices.Contains(extensions, alps) || slices.Contains(extensions, staleAlps) {
+					t.Errorf("Chrome %d extensions %v, want ALPS %s", version, extensions, alps)
+				}
+			case "Firefox":
+				wantMLKEM = version >= 132
+			}
+			if got := curves[0] == "4588"; got != wantMLKEM {
+				t.Errorf("%s %d curves %v, X25519MLKEM768 first = %v, want %v", browser, version, curves, got, wantMLKEM)
+			}
+			if slices.Contains(curves[1:], "4588") {
+				t.Errorf("X25519MLKEM768 must be the first curve: %v", curves)
+			}
+		})
+	}
+}
+
+func TestProfileSpecs(t *testing.T) {
+	for _, name := range ProfileNames() {
+		profile := profiles[name]
+		t.Run(name, func(t *testing.T) {
+			spec, err := StringToSpec(profile.JA3, profile.UserAgent, false)
+			if err != nil {
+				t.Fatalf("StringToSpec err: %v", err)
+			}
+			var groups []utls.CurveID
+			for _, ext := range spec.Extensions {
+				if keyShare, ok := ext.(*utls.KeyShareExtension); ok {
+					for _, share := range keyShare.KeyShares {
+						groups = append(groups, share.Group)
+					}
+				}
+			}
+			mlkem := slices.Index(groups, utls.X25519MLKEM768)
+			x25519 := slices.Index(groups, utls.X25519)
+			if strings.Contains(profile.JA3, ",4588-") != (mlkem >= 0) || (mlkem >= 0 && mlkem > x25519) {
+				t.Errorf("key shares %v do not match ja3 %q", groups, profile.JA3)
+			}
+
+			fingerprint, err := parseHTTP2Fingerprint(profile.HTTP2)
+			if err != nil || fingerprint == nil {
+				t.Fatalf("parseHTTP2Fingerprint(%q) = %v, %v", profile.HTTP2, fingerprint, err)
+			}
+			browser, _ := profileVersion(t, profile)
+			want := map[string]string{
+				"Chrome":  ":method,:authority,:scheme,:path",
+				"Firefox": ":method,:path,:authority,:scheme",
+			}[browser]
+			if got := strings.Join(fingerprint.PseudoHeaderOrder, ","); want != "" && got != want {
+				t.Errorf("pseudo header order = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestParseHTTP2Fingerprint(t *testing.T) {
+	got, err := parseHTTP2Fingerprint("1:65536;4:131072|12517377|3:0:0:201,5:1:3:101|m,p,a,s")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := &http2Fingerprint{
+		Settings: []http2.Setting{
+			{ID: http2.SettingHeaderTableSize, Val: 65536},
+			{ID: http2.SettingInitialWindowSize, Val: 131072},
+		},
+		ConnectionFlow: 12517377,
+		PriorityFrames: []http2.PriorityFrame{
+			{FrameHeader: http2.FrameHeader{StreamID: 3}, PriorityParam: http2.PriorityParam{Weight: 200}},
+			{FrameHeader: http2.FrameHeader{StreamID: 5}, PriorityParam: http2.PriorityParam{Exclusive: true, StreamDep: 3, Weight: 100}},
+		},
+		PseudoHeaderOrder: []string{":method", ":path", ":authority", ":scheme"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fingerprint = %+v, want %+v", got, want)
+	}
+
+	if got, err := parseHTTP2Fingerprint(""); got != nil || err != nil {
+		t.Errorf("empty fingerprint = %v, %v, want nil", got, err)
+	}
+	for _, fingerprint := range []string{
+		"1:65536|15663105|0",
+		"1=65536|15663105|0|m,a,s,p",
+		"1:65536|0|0|m,a,s,p",
+		"1:65536|15663105|3:0:0:0|m,a,s,p",
+		"1:65536|15663105|0|m,a,s",
+		"1:65536|15663105|0|m,m,s,p",
+	} {
+		if _, err := parseHTTP2Fingerprint(fingerprint); err == nil {
+			t.Errorf("parseHTTP2Fingerprint(%q) err = nil", fingerprint)
+		}
+	}
+}
+
+func TestProfileHandshake(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	}))
+	ts.EnableHTTP2 = true
+	ts.StartTLS()
+	defer ts.Close()
+
+	for _, name := range ProfileNames() {
+		t.Run(name, func(t *testing.T) {
+			options := Options{InsecureSkipVerify: true}
+			profiles[name].Apply(&options)
+			response, err := Init().Do(ts.URL, options, "GET")
+			if err != nil {
+				t.Fatalf("Do err: %v", err)
+			}
+			if response.Status != http.StatusOK || response.Body != "HTTP/2.0" {
+				t.Errorf("response = %d %q, want 200 HTTP/2.0", response.Status, response.Body)
+			}
+		})
+	}
+}
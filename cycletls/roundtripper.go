@@ -5,9 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"net"
-
 	"strings"
 	"sync"
+	"time"
 
 	http "github.com/Danny-Dasilva/fhttp"
 	http2 "github.com/Danny-Dasilva/fhttp/http2"
@@ -17,11 +17,19 @@ import (
 
 var errProtocolNegotiated = errors.New("protocol negotiated")
 
+const (
+	maxIdleConnsPerHost  = 16
+	idleConnTimeout      = 90 * time.Second
+	http2ReadIdleTimeout = 30 * time.Second
+	http2PingTimeout     = 15 * time.Second
+)
+
 type roundTripper struct {
 	sync.Mutex
 	// fix typing
 	JA3       string
 	UserAgent string
+	HTTP2     string
 
 	InsecureSkipVerify bool
 	Cookies            []Cookie
@@ -30,11 +38,41 @@ type roundTripper struct {
 
 	dialer     proxy.ContextDialer
 	forceHTTP1 bool
+
+	// negotiateMu 保证同一时间只有一个请求在协商协议,其余请求等待后复用其 transport
+	negotiateMu sync.Mutex
 }
 
 func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	addCookies(req, rt.Cookies)
+	req.Header.Set("User-Agent", rt.UserAgent)
+	addr := rt.getDialTLSAddr(req)
+	transport := rt.cachedTransport(addr)
+	if transport == nil {
+		var err error
+		if transport, err = rt.negotiateTransport(req, addr); err != nil {
+			return nil, err
+		}
+	}
+	return transport.RoundTrip(req)
+}
+
+func (rt *roundTripper) negotiateTransport(req *http.Request, addr string) (http.RoundTripper, error) {
+	rt.negotiateMu.Lock()
+	defer rt.negotiateMu.Unlock()
+	if transport := rt.cachedTransport(addr); transport != nil {
+		return transport, nil
+	}
+	if err := rt.getTransport(req, addr); err != nil {
+		return nil, err
+	}
+	return rt.cachedTransport(addr), nil
+}
+
+// addCookies 将 Cookie 添加到请求头
+func addCookies(req *http.Request, cookies []Cookie) {
 	// Fix this later for proper cookie parsing
-	for _, properties := range rt.Cookies {
+	for _, properties := range cookies {
 		req.AddCookie(&http.Cookie{
 			Name:       properties.Name,
 			Value:      properties.Value,
@@ -49,32 +87,38 @@ func (rt *roundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 			Unparsed:   properties.Unparsed,
 		})
 	}
-	req.Header.Set("User-Agent", rt.UserAgent)
-	addr := rt.getDialTLSAddr(req)
-	if _, ok := rt.cachedTransports[addr]; !ok {
-		if err := rt.getTransport(req, addr); err != nil {
-			return nil, err
-		}
-	}
-	return rt.cachedTransports[addr].RoundTrip(req)
+}
+
+func (rt *roundTripper) cachedTransport(addr string) http.RoundTripper {
+	rt.Lock()
+	defer rt.Unlock()
+	return rt.cachedTransports[addr]
 }
 
 func (rt *roundTripper) getTransport(req *http.Request, addr string) error {
 	switch strings.ToLower(req.URL.Scheme) {
 	case "http":
-		rt.cachedTransports[addr] = &http.Transport{DialContext: rt.dialer.DialContext, DisableKeepAlives: true}
+		rt.Lock()
+		if rt.cachedTransports[addr] == nil {
+			rt.cachedTransports[addr] = &http.Transport{
+				DialContext:         rt.dialer.DialContext,
+				MaxIdleConnsPerHost: maxIdleConnsPerHost,
+				IdleConnTimeout:     idleConnTimeout,
+			}
+		}
+		rt.Unlock()
 		return nil
 	case "https":
 	default:
 		return fmt.Errorf("invalid URL scheme: [%v]", req.URL.Scheme)
 	}
 
-	_, err := rt.dialTLS(req.Context(), "tcp", addr)
+	conn, err := rt.dialTLS(req.Context(), "tcp", addr)
 	switch err {
 	case errProtocolNegotiated:
 	case nil:
-		// Should never happen.
-		panic("dialTLS returned no error when determining cachedTransports")
+		// 并发请求已先一步创建了 transport,多余的连接直接关闭
+		_ = conn.Close()
 	default:
 		return err
 	}
@@ -83,14 +127,17 @@ func (rt *roundTripper) getTransport(req *http.Request, addr string) error {
 }
 
 func (rt *roundTripper) dialTLS(ctx context.Context, network, addr string) (net.Conn, error) {
-	rt.Lock()
-	defer rt.Unlock()
-
 	// If we have the connection from when we determined the HTTPS
-	// cachedTransports to use, return that.
+	// cachedTransports to use, return that. 暂存的连接只能使用一次
+	rt.Lock()
 	if conn := rt.cachedConnections[addr]; conn != nil {
+		delete(rt.cachedConnections, addr)
+		rt.Unlock()
 		return conn, nil
 	}
+	rt.Unlock()
+
+	// 握手期间不持有锁,避免新建连接相互阻塞
 	rawConn, err := rt.dialer.DialContext(ctx, network, addr)
 	if err != nil {
 		return nil, err
@@ -104,6 +151,7 @@ func (rt *roundTripper) dialTLS(ctx context.Context, network, addr string) (net.
 
 	spec, err := StringToSpec(rt.JA3, rt.UserAgent, rt.forceHTTP1)
 	if err != nil {
+		_ = rawConn.Close()
 		return nil, err
 	}
 
@@ -113,10 +161,11 @@ func (rt *roundTripper) dialTLS(ctx context.Context, network, addr string) (net.
 		utls.HelloCustom)
 
 	if err := conn.ApplyPreset(spec); err != nil {
+		_ = conn.Close()
 		return nil, err
 	}
 
-	if err = conn.Handshake(); err != nil {
+	if err = conn.HandshakeContext(ctx); err != nil {
 		_ = conn.Close()
 
 		if err.Error() == "tls: CurvePreferences includes unsupported curve" {
@@ -126,6 +175,8 @@ func (rt *roundTripper) dialTLS(ctx context.Context, network, addr string) (net.
 		return nil, fmt.Errorf("uTlsConn.Handshake() error: %+v", err)
 	}
 
+	rt.Lock()
+	defer rt.Unlock()
 	if rt.cachedTransports[addr] != nil {
 		return conn, nil
 	}
@@ -135,17 +186,38 @@ func (rt *roundTripper) dialTLS(ctx context.Context, network, addr string) (net.
 	switch conn.ConnectionState().NegotiatedProtocol {
 	case http2.NextProtoTLS:
 		parsedUserAgent := parseUserAgent(rt.UserAgent)
+		fingerprint, err := parseHTTP2Fingerprint(rt.HTTP2)
+		if err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
 
 		t2 := http2.Transport{
 			DialTLS:     rt.dialTLSHTTP2,
 			PushHandler: &http2.DefaultPushHandler{},
 			Navigator:   parsedUserAgent.UserAgent,
+			// 定期探测空闲连接,及时发现已被上游断开的连接
+			ReadIdleTimeout: http2ReadIdleTimeout,
+			PingTimeout:     http2PingTimeout,
+		}
+		if fingerprint != nil {
+			// 按指纹发送连接前言中的帧。Navigator 固定为 chrome,
+			// 指纹中没有 PRIORITY 帧时 fhttp 不会补发 firefox 的默认优先级帧
+			t2.Navigator = http2.Chrome
+			t2.HTTP2Settings = &http2.HTTP2Settings{
+				Settings:       fingerprint.Settings,
+				ConnectionFlow: int(fingerprint.ConnectionFlow),
+				PriorityFrames: fingerprint.PriorityFrames,
+			}
 		}
 		rt.cachedTransports[addr] = &t2
 	default:
 		// Assume the remote peer is speaking HTTP 1.x + TLS.
-		rt.cachedTransports[addr] = &http.Transport{DialTLSContext: rt.dialTLS, DisableKeepAlives: true}
-
+		rt.cachedTransports[addr] = &http.Transport{
+			DialTLSContext:      rt.dialTLS,
+			MaxIdleConnsPerHost: maxIdleConnsPerHost,
+			IdleConnTimeout:     idleConnTimeout,
+		}
 	}
 
 	// Stash the connection just established for use servicing the
@@ -168,10 +240,17 @@ func (rt *roundTripper) getDialTLSAddr(req *http.Request) string {
 }
 
 func (rt *roundTripper) CloseIdleConnections() {
+	rt.Lock()
+	defer rt.Unlock()
 	for addr, conn := range rt.cachedConnections {
 		_ = conn.Close()
 		delete(rt.cachedConnections, addr)
 	}
+	for _, transport := range rt.cachedTransports {
+		if closer, ok := transport.(interface{ CloseIdleConnections() }); ok {
+			closer.CloseIdleConnections()
+		}
+	}
 }
 
 func newRoundTripper(browser Browser, dialer ...proxy.ContextDialer) http.RoundTripper {
@@ -181,6 +260,7 @@ func newRoundTripper(browser Browser, dialer ...proxy.ContextDialer) http.RoundT
 			dialer:             dialer[0],
 			JA3:                browser.JA3,
 			UserAgent:          browser.UserAgent,
+			HTTP2:              browser.HTTP2,
 			Cookies:            browser.Cookies,
 			cachedTransports:   make(map[string]http.RoundTripper),
 			cachedConnections:  make(map[string]net.Conn),
@@ -193,6 +273,7 @@ func newRoundTripper(browser Browser, dialer ...proxy.ContextDialer) http.RoundT
 		dialer:             proxy.Direct,
 		JA3:                browser.JA3,
 		UserAgent:          browser.UserAgent,
+		HTTP2:              browser.HTTP2,
 		Cookies:            browser.Cookies,
 		cachedTransports:   make(map[string]http.RoundTripper),
 		cachedConnections:  make(map[string]net.Conn),
@@ -0,0 +1,145 @@
+package cycletls
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxSSELineSize 单行的最大长度,超出时返回 ErrSSELineTooLong,避免异常上游占满内存
+const maxSSELineSize = 4 << 20
+
+var ErrSSELineTooLong = errors.New("sse: line too long")
+
+// SSEEvent 按 HTML Living Standard 中 event-stream 格式解析出的事件
+type SSEEvent struct {
+	Event string // 事件类型,未指定时为 message
+	Id    string // 最近一次收到的事件ID,会延续到之后的事件
+	Data  string // 多个 data 字段以 \n 连接
+	Retry int    // 重连间隔(毫秒),未指定时为-1
+}
+
+// SSEDecoder 从 event-stream 中依次读取事件,支持 LF、CRLF 与 CR 换行、注释行与 BOM
+type SSEDecoder struct {
+	r           *bufio.Reader
+	lastEventId string
+	skipLF      bool // 上一行以 CR 结尾,紧随的 LF 属于同一个换行
+	started     bool
+	line        []byte
+}
+
+func NewSSEDecoder(r io.Reader) *SSEDecoder {
+	return &SSEDecoder{r: bufio.NewReader(r)}
+}
+
+// Next 返回下一个事件,流结束时返回 io.EOF,未以空行结束的事件按规范丢弃
+func (d *SSEDecoder) Next() (SSEEvent, error) {
+	var data bytes.Buffer
+	hasData := false
+	eventType := ""
+	retry := -1
+
+	for {
+		line, err := d.readLine()
+		if err != nil {
+			return SSEEvent{}, err
+		}
+
+		// 空行分发事件,没有 data 字段的事件不分发
+		if len(line) == 0 {
+			if !hasData {
+				eventType = ""
+				retry = -1
+				continue
+			}
+			if eventType == "" {
+				eventType = "message"
+			}
+			return SSEEvent{
+				Event: eventType,
+				Id:    d.lastEventId,
+				Data:  strings.TrimSuffix(data.String(), "\n"),
+				Retry: retry,
+			}, nil
+		}
+
+		// 注释行
+		if line[0] == ':' {
+			continue
+		}
+
+		field, value := line, []byte(nil)
+		if i := bytes.IndexByte(line, ':'); i >= 0 {
+			field, value = line[:i], line[i+1:]
+			value = bytes.TrimPrefix(value, []byte(" "))
+		}
+
+		switch string(field) {
+		case "event":
+			eventType = string(value)
+		case "data":
+			data.Write(value)
+			data.WriteByte('\n')
+			hasData = true
+		case "id":
+			if bytes.IndexByte(value, 0) < 0 {
+				d.lastEventId = string(value)
+			}
+		case "retry":
+			if isASCIIDigits(value) {
+				if n, err := strconv.Atoi(string(value)); err == nil {
+					retry = n
+				}
+			}
+		}
+	}
+}
+
+// readLine 读取一行(不含换行符),返回的切片在下次调用前有效
+func (d *SSEDecoder) readLine() ([]byte, error) {
+	d.line = d.line[:0]
+	for {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if d.skipLF {
+			d.skipLF = false
+			if b == '\n' {
+				continue
+			}
+		}
+		switch b {
+		case '\n':
+			return d.stripBOM(), nil
+		case '\r':
+			d.skipLF = true
+			return d.stripBOM(), nil
+		}
+		if len(d.line) >= maxSSELineSize {
+			return nil, ErrSSELineTooLong
+		}
+		d.line = append(d.line, b)
+	}
+}
+
+// stripBOM 去掉流开头的 UTF-8 BOM
+func (d *SSEDecoder) stripBOM() []byte {
+	if !d.started {
+		d.started = true
+		return bytes.TrimPrefix(d.line, []byte("\xEF\xBB\xBF"))
+	}
+	return d.line
+}
+
+func isASCIIDigits(value []byte) bool {
+	for _, b := range value {
+		if b < '0' || b > '9' {
+			return false
+		}
+	}
+	return len(value) > 0
+}
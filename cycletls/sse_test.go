@@ -0,0 +1,184 @@
+package cycletls
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// readAllEvents 读取流中的全部事件,直到 io.EOF 或其他错误
+func readAllEvents(input string) ([]SSEEvent, error) {
+	d := NewSSEDecoder(strings.NewReader(input))
+	var events []SSEEvent
+	for {
+		event, err := d.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return events, nil
+			}
+			return events, err
+		}
+		events = append(events, event)
+	}
+}
+
+func TestSSEDecoderNext(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  []SSEEvent
+	}{
+		{
+			name:  "lf",
+			input: "data: hello\n\n",
+			want:  []SSEEvent{{Event: "message", Data: "hello", Retry: -1}},
+		},
+		{
+			name:  "crlf",
+			input: "event: add\r\ndata: hello\r\n\r\n",
+			want:  []SSEEvent{{Event: "add", Data: "hello", Retry: -1}},
+		},
+		{
+			name:  "cr",
+			input: "data: a\rdata: b\r\r",
+			want:  []SSEEvent{{Event: "message", Data: "a\nb", Retry: -1}},
+		},
+		{
+			name:  "mixed line endings",
+			input: "data: a\r\ndata: b\rdata: c\n\r\n",
+			want:  []SSEEvent{{Event: "message", Data: "a\nb\nc", Retry: -1}},
+		},
+		{
+			name:  "bom",
+			input: "\xEF\xBB\xBFdata: hello\n\n",
+			want:  []SSEEvent{{Event: "message", Data: "hello", Retry: -1}},
+		},
+		{
+			name:  "bom only stripped at start",
+			input: "data: a\n\n\xEF\xBB\xBFdata: b\n\n",
+			want:  []SSEEvent{{Event: "message", Data: "a", Retry: -1}},
+		},
+		{
+			name:  "comments",
+			input: ": ping\n:\ndata: hello\n: trailing\n\n",
+			want:  []SSEEvent{{Event: "message", Data: "hello", Retry: -1}},
+		},
+		{
+			name:  "multi-line data",
+			input: "data: {\ndata:   \"a\": 1\ndata: }\n\n",
+			want:  []SSEEvent{{Event: "message", Data: "{\n  \"a\": 1\n}", Retry: -1}},
+		},
+		{
+			name:  "empty data field",
+			input: "data\n\ndata:\ndata:\n\n",
+			want: []SSEEvent{
+				{Event: "message", Data: "", Retry: -1},
+				{Event: "message", Data: "\n", Retry: -1},
+			},
+		},
+		{
+			name:  "only first space stripped",
+			input: "data:  two spaces\n\n",
+			want:  []SSEEvent{{Event: "message", Data: " two spaces", Retry: -1}},
+		},
+		{
+			name:  "id persists across events",
+			input: "id: 1\ndata: a\n\ndata: b\n\nid\ndata: c\n\n",
+			want: []SSEEvent{
+				{Event: "message", Id: "1", Data: "a", Retry: -1},
+				{Event: "message", Id: "1", Data: "b", Retry: -1},
+				{Event: "message", Id: "", Data: "c", Retry: -1},
+			},
+		},
+		{
+			name:  "id containing nul ignored",
+			input: "id: 1\ndata: a\n\nid: 2\x003\ndata: b\n\n",
+			want: []SSEEvent{
+				{Event: "message", Id: "1", Data: "a", Retry: -1},
+				{Event: "message", Id: "1", Data: "b", Retry: -1},
+			},
+		},
+		{
+			name:  "retry",
+			input: "retry: 3000\ndata: a\n\n",
+			want:  []SSEEvent{{Event: "message", Data: "a", Retry: 3000}},
+		},
+		{
+			name:  "invalid retry ignored",
+			input: "retry: 3s\ndata: a\n\nretry: -1\ndata: b\n\nretry:\ndata: c\n\nretry: 99999999999999999999\ndata: d\n\n",
+			want: []SSEEvent{
+				{Event: "message", Data: "a", Retry: -1},
+				{Event: "message", Data: "b", Retry: -1},
+				{Event: "message", Data: "c", Retry: -1},
+				{Event: "message", Data: "d", Retry: -1},
+			},
+		},
+		{
+			name:  "event without data not dispatched",
+			input: "event: ping\n\ndata: a\n\n",
+			want:  []SSEEvent{{Event: "message", Data: "a", Retry: -1}},
+		},
+		{
+			name:  "unknown fields ignored",
+			input: "foo: bar\ndata: a\nfield without colon\n\n",
+			want:  []SSEEvent{{Event: "message", Data: "a", Retry: -1}},
+		},
+		{
+			name:  "unterminated event discarded",
+			input: "data: a\n\ndata: b\n",
+			want:  []SSEEvent{{Event: "message", Data: "a", Retry: -1}},
+		},
+		{
+			name:  "empty stream",
+			input: "",
+			want:  nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readAllEvents(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("events = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSSEDecoderLineTooLong(t *testing.T) {
+	input := "data: " + strings.Repeat("a", maxSSELineSize) + "\n\n"
+	if _, err := readAllEvents(input); !errors.Is(err, ErrSSELineTooLong) {
+		t.Fatalf("err = %v, want %v", err, ErrSSELineTooLong)
+	}
+}
+
+func FuzzSSEDecoder(f *testing.F) {
+	f.Add([]byte("data: hello\n\n"))
+	f.Add([]byte("event: add\r\ndata: a\r\ndata: b\r\n\r\n"))
+
+	f.Fuzz(func(t *testing.T, input []byte) {
+		events, err := readAllEvents(string(input))
+		if err != nil && !errors.Is(err, ErrSSELineTooLong) {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		for _, event := range events {
+			if event.Event == "" {
+				t.Errorf("empty event type: %#v", event)
+			}
+			if strings.ContainsAny(event.Event+event.Id+event.Data, "\r") {
+				t.Errorf("event contains CR: %#v", event)
+			}
+			if strings.ContainsRune(event.Id, 0) {
+				t.Errorf("id contains NUL: %#v", event)
+			}
+			if event.Retry < -1 {
+				t.Errorf("invalid retry: %#v", event)
+			}
+		}
+	})
+}
@@ -8,6 +8,8 @@ import (
 	"encoding/base64"
 	"encoding/json"
 	"errors"
+	"fmt"
+	http2 "github.com/Danny-Dasilva/fhttp/http2"
 	"github.com/andybalholm/brotli"
 	utls "github.com/refraction-networking/utls"
 	"io"
@@ -25,19 +27,118 @@ type UserAgent struct {
 	HeaderOrder []string
 }
 
-// ParseUserAgent returns the pseudo header order and user agent string for chrome/firefox
+// ParseUserAgent returns the pseudo header order and user agent string for chrome/firefox/safari.
+// 仅在未指定 HTTP/2 指纹时使用,指纹见 parseHTTP2Fingerprint
 func parseUserAgent(userAgent string) UserAgent {
 	switch {
 	case strings.Contains(strings.ToLower(userAgent), "chrome"):
 		return UserAgent{chrome, []string{":method", ":authority", ":scheme", ":path"}}
 	case strings.Contains(strings.ToLower(userAgent), "firefox"):
 		return UserAgent{firefox, []string{":method", ":path", ":authority", ":scheme"}}
+	case strings.Contains(strings.ToLower(userAgent), "safari"):
+		// Safari 的 HTTP/2 设置沿用 chrome,伪头部顺序不同
+		return UserAgent{chrome, []string{":method", ":scheme", ":path", ":authority"}}
 	default:
 		return UserAgent{chrome, []string{":method", ":authority", ":scheme", ":path"}}
 	}
 
 }
 
+// http2Fingerprint HTTP/2 连接指纹:连接建立时发送的 SETTINGS、WINDOW_UPDATE、PRIORITY 帧与伪头部顺序
+type http2Fingerprint struct {
+	Settings          []http2.Setting
+	ConnectionFlow    uint32
+	PriorityFrames    []http2.PriorityFrame
+	PseudoHeaderOrder []string
+}
+
+var pseudoHeaders = map[string]string{
+	"m": ":method",
+	"a": ":authority",
+	"s": ":scheme",
+	"p": ":path",
+}
+
+// parseHTTP2Fingerprint 解析 Akamai 格式的 HTTP/2 指纹,如
+// "1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p",
+// 依次为 SETTINGS(id:值)、WINDOW_UPDATE 增量、PRIORITY 帧(流ID:exclusive:依赖流ID:权重,0表示不发送)与伪头部顺序。
+// fingerprint 为空时返回 nil
+func parseHTTP2Fingerprint(fingerprint string) (*http2Fingerprint, error) {
+	if fingerprint == "" {
+		return nil, nil
+	}
+	tokens := strings.Split(fingerprint, "|")
+	if len(tokens) != 4 {
+		return nil, fmt.Errorf("invalid http2 fingerprint: %s", fingerprint)
+	}
+
+	var result http2Fingerprint
+	for _, setting := range strings.Split(tokens[0], ";") {
+		id, val, ok := strings.Cut(setting, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid http2 setting: %s", setting)
+		}
+		settingId, err := strconv.ParseUint(id, 10, 16)
+		if err != nil {
+			return nil, err
+		}
+		settingVal, err := strconv.ParseUint(val, 10, 32)
+		if err != nil {
+			return nil, err
+		}
+		result.Settings = append(result.Settings, http2.Setting{ID: http2.SettingID(settingId), Val: uint32(settingVal)})
+	}
+
+	connectionFlow, err := strconv.ParseUint(tokens[1], 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	if connectionFlow == 0 {
+		return nil, fmt.Errorf("invalid http2 window update: %s", tokens[1])
+	}
+	result.ConnectionFlow = uint32(connectionFlow)
+
+	if tokens[2] != "0" {
+		for _, frame := range strings.Split(tokens[2], ",") {
+			fields := strings.Split(frame, ":")
+			if len(fields) != 4 {
+				return nil, fmt.Errorf("invalid http2 priority frame: %s", frame)
+			}
+			var values [4]uint64
+			for i, field := range fields {
+				if values[i], err = strconv.ParseUint(field, 10, 32); err != nil {
+					return nil, err
+				}
+			}
+			if values[3] < 1 || values[3] > 256 {
+				return nil, fmt.Errorf("invalid http2 priority weight: %s", frame)
+			}
+			result.PriorityFrames = append(result.PriorityFrames, http2.PriorityFrame{
+				FrameHeader: http2.FrameHeader{StreamID: uint32(values[0])},
+				PriorityParam: http2.PriorityParam{
+					Exclusive: values[1] == 1,
+					StreamDep: uint32(values[2]),
+					Weight:    uint8(values[3] - 1),
+				},
+			})
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, name := range strings.Split(tokens[3], ",") {
+		header, ok := pseudoHeaders[name]
+		if !ok || seen[name] {
+			return nil, fmt.Errorf("invalid http2 pseudo header: %s", name)
+		}
+		seen[name] = true
+		result.PseudoHeaderOrder = append(result.PseudoHeaderOrder, header)
+	}
+	if len(result.PseudoHeaderOrder) != len(pseudoHeaders) {
+		return nil, fmt.Errorf("invalid http2 pseudo header order: %s", tokens[3])
+	}
+	return &result, nil
+}
+
 // DecompressBody unzips compressed data
 func DecompressBody(Body []byte, encoding []string, content []string) (parsedBody string) {
 	if len(encoding) > 0 {
@@ -152,6 +253,19 @@ func StringToSpec(ja3 string, userAgent string, forceHTTP1 bool) (*utls.ClientHe
 			return nil, err
 		}
 		targetCurves = append(targetCurves, utls.CurveID(cid))
+		// 支持 X25519MLKEM768 的浏览器会在 X25519 之前发送其密钥
+		if utls.CurveID(cid) == utls.X25519MLKEM768 {
+			if keyShareExt, ok := extMap["51"]; ok {
+				if keyShare, ok := keyShareExt.(*utls.KeyShareExtension); ok {
+					for i, share := range keyShare.KeyShares {
+						if share.Group == utls.X25519 {
+							keyShare.KeyShares = append(keyShare.KeyShares[:i], append([]utls.KeyShare{{Group: utls.X25519MLKEM768}}, keyShare.KeyShares[i:]...)...)
+							break
+						}
+					}
+				}
+			}
+		}
 	}
 	extMap["10"] = &utls.SupportedCurvesExtension{Curves: targetCurves}
 
@@ -346,6 +460,12 @@ func genMap() (extMap map[string]utls.TLSExtension) {
 				"h2",
 			},
 		},
+		// Chrome 133 起 ALPS 改用新的扩展号
+		"17613": &utls.ApplicationSettingsExtensionNew{
+			SupportedProtocols: []string{
+				"h2",
+			},
+		},
 		"30032": &utls.GenericExtension{Id: 0x7550, Data: []byte{0}}, //FIXME
 		"65281": &utls.RenegotiationInfoExtension{
 			Renegotiation: utls.RenegotiateOnceAsClient,
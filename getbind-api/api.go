@@ -1,23 +1,31 @@
 package getbind_api
 
 import (
+	"context"
 	"fmt"
 	"getbind2api/common"
 	"getbind2api/common/config"
 	logger "getbind2api/common/loggger"
 	"getbind2api/cycletls"
-	"github.com/gin-gonic/gin"
 	"math/rand"
 	"strings"
 	"time"
 )
 
 const (
-	baseURL      = "https://api.getbind.co"
-	chatEndpoint = baseURL + "/chatbot/stream"
+	chatPath = "/chatbot/stream"
 )
 
-func MakeStreamChatRequest(c *gin.Context, client cycletls.CycleTLS, requestBody map[string]interface{}, cookie string, modelInfo common.ModelInfo) (<-chan cycletls.SSEResponse, error) {
+// chatEndpoint 返回对话接口地址,优先使用 UPSTREAM_CHAT_URL
+func chatEndpoint() string {
+	if config.UpstreamChatUrl != "" {
+		return config.UpstreamChatUrl
+	}
+	return config.UpstreamBaseUrl + chatPath
+}
+
+// MakeStreamChatRequest 向上游发起流式对话请求,routes 记录本次请求被拦截的路线,为nil时不做记录
+func MakeStreamChatRequest(ctx context.Context, client cycletls.CycleTLS, requestBody map[string]interface{}, cookie string, modelInfo common.ModelInfo, routes *Routes) (<-chan cycletls.SSEResponse, error) {
 	split := strings.Split(cookie, "=")
 	if len(split) >= 2 {
 		cookie = split[0]
@@ -70,38 +78,36 @@ func MakeStreamChatRequest(c *gin.Context, client cycletls.CycleTLS, requestBody
 	formData.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
 
 	headers := map[string]string{
-		"accept":             "text/event-stream",
-		"accept-language":    "zh-CN,zh;q=0.9,en;q=0.8",
-		"content-type":       fmt.Sprintf("multipart/form-data; boundary=%s", boundary),
-		"origin":             "https://copilot.getbind.co",
-		"priority":           "u=1, i",
-		"referer":            "https://copilot.getbind.co/",
-		"sec-ch-ua":          "\"Google Chrome\";v=\"135\", \"Not-A.Brand\";v=\"8\", \"Chromium\";v=\"135\"",
-		"sec-ch-ua-mobile":   "?0",
-		"sec-ch-ua-platform": "\"macOS\"",
-		"sec-fetch-dest":     "empty",
-		"sec-fetch-mode":     "cors",
-		"sec-fetch-site":     "same-site",
-		"user-agent":         "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/135.0.0.0 Safari/537.36",
+		"accept":          "text/event-stream",
+		"accept-language": "zh-CN,zh;q=0.9,en;q=0.8",
+		"content-type":    fmt.Sprintf("multipart/form-data; boundary=%s", boundary),
+		"origin":          config.UpstreamOrigin,
+		"referer":         config.UpstreamOrigin + "/",
+		"sec-fetch-dest":  "empty",
+		"sec-fetch-mode":  "cors",
+		"sec-fetch-site":  "same-site",
 		//"cookie":             cookie,
 	}
 
+	route := routes.next(cookie)
 	options := cycletls.Options{
 		Timeout: 10 * 60 * 60,
-		Proxy:   config.ProxyUrl, // 在每个请求中设置代理
+		Proxy:   route.Proxy, // 在每个请求中设置代理
 		Body:    formData.String(),
 		Method:  "POST",
 		Headers: headers,
 	}
+	// User-Agent、客户端提示请求头与请求头顺序由浏览器指纹决定
+	route.Profile.Apply(&options)
 
-	logger.Debug(c.Request.Context(), fmt.Sprintf("cookie: %v", cookie))
+	logger.Debug(ctx, fmt.Sprintf("cookie: %v", cookie))
 
-	sseChan, err := client.DoSSE(chatEndpoint, options, "POST")
+	sseChan, err := client.DoSSE(ctx, chatEndpoint(), options, "POST")
 	if err != nil {
-		logger.Errorf(c, "Failed to make stream request: %v", err)
+		logger.Errorf(ctx, "Failed to make stream request: %v", err)
 		return nil, fmt.Errorf("Failed to make stream request: %v", err)
 	}
-	return sseChan, nil
+	return trackRouteHealth(ctx, route, sseChan), nil
 }
 
 // 生成随机字符串，用于表单边界
@@ -0,0 +1,148 @@
+package getbind_api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"getbind2api/common"
+	"getbind2api/common/config"
+	logger "getbind2api/common/loggger"
+	"getbind2api/cycletls"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"unicode"
+)
+
+const (
+	uploadPath = "/chatbot/upload"
+)
+
+// UploadedFile 上游文件上传接口返回的文件信息,以 file_id 为键放入对话请求的 files 字段
+type UploadedFile struct {
+	FileId string `json:"file_id"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Size   int    `json:"size"`
+	Url    string `json:"url"`
+}
+
+// uploadEndpoint 返回文件上传接口地址,优先使用 UPSTREAM_UPLOAD_URL
+func uploadEndpoint() string {
+	if config.UpstreamUploadUrl != "" {
+		return config.UpstreamUploadUrl
+	}
+	return config.UpstreamBaseUrl + uploadPath
+}
+
+// UploadFile 将文件上传至上游,返回可在对话中引用的文件信息。
+// 上传接口与返回格式只对照内置的mock上游实现,尚未对照真实上游验证,需设置 FILE_UPLOAD_ENABLE 开启
+func UploadFile(ctx context.Context, client cycletls.CycleTLS, cookie string, routes *Routes, name string, data []byte, fileType *common.FileTypeResult) (*UploadedFile, error) {
+	split := strings.Split(cookie, "=")
+	if len(split) >= 2 {
+		cookie = split[0]
+	}
+
+	body, contentType, err := uploadFormData(cookie, name, data, fileType.MimeType)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to build upload form: %v", err)
+	}
+
+	headers := map[string]string{
+		"accept":          "application/json",
+		"accept-language": "zh-CN,zh;q=0.9,en;q=0.8",
+		"content-type":    contentType,
+		"origin":          config.UpstreamOrigin,
+		"referer":         config.UpstreamOrigin + "/",
+		"sec-fetch-dest":  "empty",
+		"sec-fetch-mode":  "cors",
+		"sec-fetch-site":  "same-site",
+	}
+
+	route := routes.next(cookie)
+	options := cycletls.Options{
+		Timeout: 5 * 60,
+		Proxy:   route.Proxy,
+		Body:    body,
+		Method:  "POST",
+		Headers: headers,
+	}
+	// User-Agent、客户端提示请求头与请求头顺序由浏览器指纹决定
+	route.Profile.Apply(&options)
+
+	logger.Debug(ctx, fmt.Sprintf("UploadFile: %s %s %d bytes", name, fileType.MimeType, len(data)))
+
+	response, err := client.DoWithContext(ctx, uploadEndpoint(), options, "POST")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to upload file: %v", err)
+	}
+	// 客户端断开导致的失败不计入路线失败
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("Failed to upload file: %w", ctx.Err())
+	}
+	reportRouteResult(ctx, route, response.ConnError, response.Body)
+	if response.Status != http.StatusOK {
+		if IsUpstreamBlocked(response.Body) {
+			return nil, fmt.Errorf("Failed to upload file: %w", ErrUpstreamBlocked)
+		}
+		return nil, fmt.Errorf("Failed to upload file: status %d %s", response.Status, response.Body)
+	}
+
+	var file UploadedFile
+	if err := json.Unmarshal([]byte(response.Body), &file); err != nil {
+		return nil, fmt.Errorf("Failed to parse upload response: %v %s", err, response.Body)
+	}
+	if file.FileId == "" {
+		return nil, fmt.Errorf("Failed to upload file: %s", response.Body)
+	}
+	if file.Name == "" {
+		file.Name = name
+	}
+	if file.Type == "" {
+		file.Type = fileType.MimeType
+	}
+	return &file, nil
+}
+
+// uploadFormData 构建上传请求的 multipart 表单,返回请求体与 content-type
+func uploadFormData(userId, name string, data []byte, mimeType string) (string, string, error) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	if err := writer.SetBoundary("----WebKitFormBoundary" + generateRandomString(16)); err != nil {
+		return "", "", err
+	}
+	if err := writer.WriteField("user_id", userId); err != nil {
+		return "", "", err
+	}
+
+	header := make(textproto.MIMEHeader)
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, escapeFilename(name)))
+	header.Set("Content-Type", mimeType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err = part.Write(data); err != nil {
+		return "", "", err
+	}
+	if err = writer.Close(); err != nil {
+		return "", "", err
+	}
+	return buf.String(), writer.FormDataContentType(), nil
+}
+
+// filenameEscaper 与 mime/multipart 转义文件名的方式相同
+var filenameEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// escapeFilename 去除文件名中的控制字符(包括换行)并转义引号与反斜杠,避免客户端提供的文件名注入表单头
+func escapeFilename(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	return filenameEscaper.Replace(name)
+}
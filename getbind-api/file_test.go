@@ -0,0 +1,47 @@
+package getbind_api
+
+import (
+	"context"
+	"errors"
+	"getbind2api/common"
+	"getbind2api/cycletls"
+	"testing"
+)
+
+func TestUploadFileEscapesFilename(t *testing.T) {
+	srv := newMockUpstream(t)
+	fileType := &common.FileTypeResult{MimeType: common.PDF_TYPE, Extension: ".pdf"}
+	name := "a\"b\\c\r\nX-Injected: 1\r\n\r\n.pdf"
+	file, err := UploadFile(context.Background(), cycletls.Init(), "plain-upload", nil, name, []byte("%PDF-1.4"), fileType)
+	if err != nil {
+		t.Fatalf("UploadFile: %v", err)
+	}
+
+	uploads := srv.Uploads()
+	if len(uploads) != 1 {
+		t.Fatalf("uploads = %+v, want 1", uploads)
+	}
+	upload := uploads[0]
+	wantName := "a\"b\\cX-Injected: 1.pdf"
+	if upload.Name != wantName || upload.Type != common.PDF_TYPE || string(upload.Data) != "%PDF-1.4" || upload.UserId != "plain-upload" {
+		t.Errorf("upload = %q %q %q %q, want %q %q", upload.Name, upload.Type, upload.Data, upload.UserId, wantName, common.PDF_TYPE)
+	}
+	if file.FileId != upload.FileId {
+		t.Errorf("file id = %s, want %s", file.FileId, upload.FileId)
+	}
+}
+
+func TestUploadFileCancelled(t *testing.T) {
+	srv := newMockUpstream(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	fileType := &common.FileTypeResult{MimeType: common.PNG_TYPE, Extension: ".png"}
+	_, err := UploadFile(ctx, cycletls.Init(), "plain-upload", nil, "image.png", []byte("png"), fileType)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want %v", err, context.Canceled)
+	}
+	if uploads := srv.Uploads(); len(uploads) != 0 {
+		t.Fatalf("uploads = %+v, want none after cancel", uploads)
+	}
+}
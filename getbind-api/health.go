@@ -0,0 +1,125 @@
+package getbind_api
+
+import (
+	"context"
+	"fmt"
+	"getbind2api/common"
+	"getbind2api/common/config"
+	logger "getbind2api/common/loggger"
+	"getbind2api/cycletls"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	healthCheckQuery   = `[{"role":"user","content":"hi"}]`
+	healthCheckTimeout = 60 * time.Second
+)
+
+// healthCheckMu 保证同一时间只有一轮健康检查
+var healthCheckMu sync.Mutex
+
+// StartHealthCheck 按 HEALTH_CHECK_INTERVAL 定期探测cookie池中的每个账号
+func StartHealthCheck() {
+	if config.HealthCheckInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(time.Duration(config.HealthCheckInterval) * time.Second)
+		defer ticker.Stop()
+		for {
+			CheckCookiesHealth(context.Background())
+			<-ticker.C
+		}
+	}()
+}
+
+// CheckCookiesHealth 依次探测所有未禁用的账号,包括已被隔离的账号,恢复后会重新加入cookie池
+func CheckCookiesHealth(ctx context.Context) {
+	healthCheckMu.Lock()
+	defer healthCheckMu.Unlock()
+
+	for _, info := range config.ListCookies() {
+		if info.Disabled {
+			continue
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		if _, _, err := CheckCookieHealth(ctx, info.UserId); err != nil {
+			logger.Errorf(ctx, "CheckCookieHealth err: %v", err)
+		}
+	}
+}
+
+// CheckCookieHealth 通过该账号发送一条最简短的对话请求,并根据上游响应记录账号状态
+func CheckCookieHealth(ctx context.Context, cookie string) (string, string, error) {
+	modelInfo, ok := common.GetModelInfo(config.HealthCheckModel)
+	if !ok {
+		return "", "", fmt.Errorf("health check model %s not supported", config.HealthCheckModel)
+	}
+
+	status, message := probeCookie(ctx, cookie, modelInfo)
+
+	if status == config.CookieStatusRateLimited {
+		if err := config.AddRateLimitCookie(cookie, time.Now().Add(time.Duration(config.RateLimitCookieLockDuration)*time.Second)); err != nil {
+			logger.Errorf(ctx, "Failed to save cookie pool: %v", err)
+		}
+	}
+	if err := config.SetCookieStatus(cookie, status, message); err != nil {
+		return status, message, err
+	}
+	if status != config.CookieStatusHealthy {
+		logger.Warnf(ctx, "Cookie health check: %s %s, COOKIE:%s", status, message, cookie)
+	}
+	return status, message, nil
+}
+
+func probeCookie(ctx context.Context, cookie string, modelInfo common.ModelInfo) (string, string) {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	client := cycletls.Init()
+
+	requestBody := map[string]interface{}{
+		"model":      modelInfo.Model,
+		"query":      healthCheckQuery,
+		"bot_id":     modelInfo.BotId,
+		"session_id": strings.ToLower(generateRandomString(10)),
+		"user_id":    cookie,
+		"files":      "{}",
+	}
+	sseChan, err := MakeStreamChatRequest(ctx, client, requestBody, cookie, modelInfo, nil)
+	if err != nil {
+		return config.CookieStatusError, err.Error()
+	}
+
+	for response := range sseChan {
+		data := response.Data
+		if data == "" {
+			continue
+		}
+		if response.Done && data != "[DONE]" {
+			switch {
+			case common.IsNotLogin(data):
+				return config.CookieStatusInvalid, data
+			case common.IsUsageLimitExceeded(data):
+				return config.CookieStatusUsageExhausted, data
+			case common.IsRateLimit(data):
+				return config.CookieStatusRateLimited, data
+			case response.Status == http.StatusUnauthorized:
+				return config.CookieStatusInvalid, data
+			}
+			return config.CookieStatusError, data
+		}
+		// 收到任意输出即说明账号可用,提前结束探测请求
+		return config.CookieStatusHealthy, ""
+	}
+
+	if ctx.Err() != nil {
+		return config.CookieStatusError, ctx.Err().Error()
+	}
+	return config.CookieStatusHealthy, ""
+}
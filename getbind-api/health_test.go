@@ -0,0 +1,144 @@
+package getbind_api
+
+import (
+	"context"
+	"getbind2api/common/config"
+	"getbind2api/getbind-api/mock"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+func TestMain(m *testing.M) {
+	dataPath, err := os.MkdirTemp("", "getbind2api-health-test")
+	if err != nil {
+		panic(err)
+	}
+	config.DataPath = dataPath
+	if err = config.InitDB(); err != nil {
+		panic(err)
+	}
+	if err = config.InitSGCookies(); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+	_ = config.CloseDB()
+	_ = os.RemoveAll(dataPath)
+	os.Exit(code)
+}
+
+// newMockUpstream 启动 mock 上游并将请求指向它,测试结束后恢复
+func newMockUpstream(t *testing.T) *mock.Server {
+	t.Helper()
+	srv := mock.NewServer()
+	ts := httptest.NewServer(srv)
+	baseUrl := config.UpstreamBaseUrl
+	config.UpstreamBaseUrl = ts.URL
+	t.Cleanup(func() {
+		config.UpstreamBaseUrl = baseUrl
+		ts.Close()
+	})
+	return srv
+}
+
+// addCookie 将cookie加入cookie池,测试结束后删除
+func addCookie(t *testing.T, cookie string) {
+	t.Helper()
+	if _, err := config.AddCookies([]string{cookie}); err != nil {
+		t.Fatalf("AddCookies: %v", err)
+	}
+	t.Cleanup(func() { _ = config.DeleteCookie(cookie) })
+}
+
+func cookieInfo(t *testing.T, cookie string) config.CookieInfo {
+	t.Helper()
+	info, ok := lo.Find(config.ListCookies(), func(info config.CookieInfo) bool { return info.UserId == cookie })
+	if !ok {
+		t.Fatalf("cookie %s not in pool", cookie)
+	}
+	return info
+}
+
+func available(cookie string) bool {
+	return lo.Contains(config.NewCookieManager().Cookies, cookie)
+}
+
+func TestCheckCookieHealthClassifies(t *testing.T) {
+	tests := []struct {
+		cookie        string
+		wantStatus    string
+		wantAvailable bool
+	}{
+		{"plain-health", config.CookieStatusHealthy, true},
+		{mock.UserRateLimit + "-health", config.CookieStatusRateLimited, false},
+		{mock.UserInvalidToken + "-health", config.CookieStatusInvalid, false},
+		{mock.UserUsageExhausted + "-health", config.CookieStatusUsageExhausted, false},
+		{mock.UserServerError + "-health", config.CookieStatusError, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.cookie, func(t *testing.T) {
+			newMockUpstream(t)
+			addCookie(t, tt.cookie)
+
+			status, _, err := CheckCookieHealth(context.Background(), tt.cookie)
+			if err != nil {
+				t.Fatalf("CheckCookieHealth: %v", err)
+			}
+			if status != tt.wantStatus || cookieInfo(t, tt.cookie).Status != tt.wantStatus {
+				t.Errorf("status = %q, want %q", status, tt.wantStatus)
+			}
+			if available(tt.cookie) != tt.wantAvailable {
+				t.Errorf("available = %v, want %v", available(tt.cookie), tt.wantAvailable)
+			}
+		})
+	}
+}
+
+func TestCheckCookieHealthRestoresCookie(t *testing.T) {
+	t.Run("rate limit lock", func(t *testing.T) {
+		newMockUpstream(t)
+		cookie := "plain-locked"
+		addCookie(t, cookie)
+		if err := config.AddRateLimitCookie(cookie, time.Now().Add(time.Hour)); err != nil {
+			t.Fatalf("AddRateLimitCookie: %v", err)
+		}
+		if available(cookie) {
+			t.Fatalf("locked cookie is available")
+		}
+
+		status, _, err := CheckCookieHealth(context.Background(), cookie)
+		if err != nil || status != config.CookieStatusHealthy {
+			t.Fatalf("CheckCookieHealth = %q, %v", status, err)
+		}
+		if !available(cookie) {
+			t.Errorf("healthy cookie is still locked")
+		}
+		if info := cookieInfo(t, cookie); info.RateLimitUntil != nil {
+			t.Errorf("RateLimitUntil = %v, want nil", info.RateLimitUntil)
+		}
+	})
+
+	t.Run("quarantine", func(t *testing.T) {
+		srv := newMockUpstream(t)
+		cookie := "plain-quarantined"
+		addCookie(t, cookie)
+		if err := config.SetCookieStatus(cookie, config.CookieStatusInvalid, mock.InvalidTokenBody); err != nil {
+			t.Fatalf("SetCookieStatus: %v", err)
+		}
+		if available(cookie) {
+			t.Fatalf("quarantined cookie is available")
+		}
+
+		CheckCookiesHealth(context.Background())
+		if len(srv.Requests()) == 0 {
+			t.Fatalf("quarantined cookie was not probed")
+		}
+		if !available(cookie) {
+			t.Errorf("recovered cookie is still quarantined")
+		}
+	})
+}
@@ -0,0 +1,312 @@
+// Package mock 提供一个本地的 Getbind 上游替身,
+// 与 getbind_api.MakeStreamChatRequest 使用相同的 multipart 协议,
+// 用于在不消耗真实账号的情况下进行端到端测试。
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 上游返回的错误响应体,与 common.IsRateLimit / IsNotLogin / IsUsageLimitExceeded / IsServerError / IsCloudflareBlock 的判断保持一致
+const (
+	RateLimitBody          = `{"error":"Too many concurrent requests","message":"You have reached your maximum concurrent request limit. Please try again later."}`
+	InvalidTokenBody       = `{"error":"Invalid token"}`
+	UsageLimitBody         = `{"error":"Usage limit exceeded","message":"You have reached your Kilo Code usage limit. Please upgrade your plan."}`
+	ServiceUnavailableBody = `{"error":"Service Unavailable","message":"The service is temporarily unavailable. Please try again later."}`
+	CloudflareBlockBody    = "<!DOCTYPE html>\n<html lang=\"en-US\">\n<head>\n<title>Attention Required! | Cloudflare</title>\n</head>\n<body>\n<div class=\"cf-wrapper\">\n<h1 data-translate=\"block_headline\">Sorry, you have been blocked</h1>\n</div>\n</body>\n</html>"
+)
+
+// 内置场景对应的 user_id 前缀
+const (
+	UserRateLimit        = "mock-ratelimit"
+	UserInvalidToken     = "mock-invalid"
+	UserUsageExhausted   = "mock-exhausted"
+	UserServerError      = "mock-503"
+	UserServerErrorEmpty = "mock-503-empty"
+	UserSlow             = "mock-slow"
+	UserCloudflareBlock  = "mock-cloudflare"
+)
+
+// slowInterval mock-slow 场景下数据块之间的间隔
+const slowInterval = 500 * time.Millisecond
+
+const (
+	ChatPath   = "/chatbot/stream"
+	UploadPath = "/chatbot/upload"
+	FilesPath  = "/files/"
+)
+
+// Scenario 描述一次请求的脚本化响应
+type Scenario struct {
+	Status   int           // 非0且非200时直接以该状态码返回 Body
+	Body     string        // 错误响应体
+	Chunks   []string      // 流式返回的数据块,每个数据行经代理读取后带换行符;为空时回显最后一条用户消息
+	Interval time.Duration // 数据块之间的间隔
+}
+
+// Request 记录 mock 收到的表单字段,便于测试断言
+type Request struct {
+	Model     string
+	Query     string
+	BotId     string
+	SessionId string
+	UserId    string
+	Files     string
+	Context   string
+}
+
+// Upload 记录 mock 收到的上传文件
+type Upload struct {
+	FileId string
+	UserId string
+	Name   string
+	Type   string
+	Data   []byte
+}
+
+type Server struct {
+	mu        sync.Mutex
+	scenarios map[string]Scenario
+	requests  []Request
+	uploads   []Upload
+	cancelled int
+}
+
+func NewServer() *Server {
+	return &Server{
+		scenarios: map[string]Scenario{},
+	}
+}
+
+// Uploads 返回已收到上传文件的副本
+func (s *Server) Uploads() []Upload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	uploads := make([]Upload, len(s.uploads))
+	copy(uploads, s.uploads)
+	return uploads
+}
+
+// Script 为指定 user_id 设置脚本化响应
+func (s *Server) Script(userId string, scenario Scenario) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.scenarios[userId] = scenario
+}
+
+// Requests 返回已收到请求的副本
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	requests := make([]Request, len(s.requests))
+	copy(requests, s.requests)
+	return requests
+}
+
+// Start 在 addr 上启动 mock 服务,返回可用作 UPSTREAM_BASE_URL 的地址
+func Start(addr string) (*Server, string, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, "", err
+	}
+	server := NewServer()
+	go func() {
+		_ = http.Serve(listener, server)
+	}()
+	return server, "http://" + listener.Addr().String(), nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == ChatPath:
+		s.serveChat(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == UploadPath:
+		s.serveUpload(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serveUpload 保存上传的文件并返回文件信息,user_id 的内置场景同样适用
+func (s *Server) serveUpload(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, fmt.Sprintf("invalid multipart form: %v", err), http.StatusBadRequest)
+		return
+	}
+	userId := r.FormValue("user_id")
+	if scenario := builtinScenario(userId); scenario.Status != 0 {
+		w.WriteHeader(scenario.Status)
+		_, _ = w.Write([]byte(scenario.Body))
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, fmt.Sprintf("missing file: %v", err), http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	upload := Upload{
+		FileId: fmt.Sprintf("mock-file-%d", len(s.uploads)+1),
+		UserId: userId,
+		Name:   header.Filename,
+		Type:   header.Header.Get("Content-Type"),
+		Data:   data,
+	}
+	s.uploads = append(s.uploads, upload)
+	s.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"file_id": upload.FileId,
+		"name":    upload.Name,
+		"type":    upload.Type,
+		"size":    len(data),
+		"url":     "http://" + r.Host + FilesPath + upload.FileId,
+	})
+}
+
+func (s *Server) serveChat(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		http.Error(w, fmt.Sprintf("invalid multipart form: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	req := Request{
+		Model:     r.FormValue("model"),
+		Query:     r.FormValue("query"),
+		BotId:     r.FormValue("bot_id"),
+		SessionId: r.FormValue("session_id"),
+		UserId:    r.FormValue("user_id"),
+		Files:     r.FormValue("files"),
+		Context:   r.FormValue("context"),
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, req)
+	scenario, ok := s.scenarios[req.UserId]
+	s.mu.Unlock()
+	if !ok {
+		scenario = builtinScenario(req.UserId)
+	}
+
+	if scenario.Status != 0 && scenario.Status != http.StatusOK {
+		w.WriteHeader(scenario.Status)
+		_, _ = w.Write([]byte(scenario.Body))
+		return
+	}
+
+	chunks := scenario.Chunks
+	if len(chunks) == 0 {
+		chunks = echoChunks(req.Query)
+		if strings.HasSuffix(req.Model, ThinkingModelSuffix) {
+			chunks = append([]string{"<think>Mock thinking.</think>"}, chunks...)
+		}
+	}
+	if !writeStream(w, r, chunks, scenario.Interval) {
+		s.mu.Lock()
+		s.cancelled++
+		s.mu.Unlock()
+	}
+}
+
+// Cancelled 返回在输出完成前被调用方断开的请求数
+func (s *Server) Cancelled() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.cancelled
+}
+
+func builtinScenario(userId string) Scenario {
+	switch {
+	case strings.HasPrefix(userId, UserServerErrorEmpty):
+		return Scenario{Status: http.StatusServiceUnavailable}
+	case strings.HasPrefix(userId, UserServerError):
+		return Scenario{Status: http.StatusServiceUnavailable, Body: ServiceUnavailableBody}
+	case strings.HasPrefix(userId, UserRateLimit):
+		return Scenario{Status: http.StatusTooManyRequests, Body: RateLimitBody}
+	case strings.HasPrefix(userId, UserInvalidToken):
+		return Scenario{Status: http.StatusUnauthorized, Body: InvalidTokenBody}
+	case strings.HasPrefix(userId, UserUsageExhausted):
+		return Scenario{Status: http.StatusPaymentRequired, Body: UsageLimitBody}
+	case strings.HasPrefix(userId, UserSlow):
+		return Scenario{Interval: slowInterval}
+	case strings.HasPrefix(userId, UserCloudflareBlock):
+		return Scenario{Status: http.StatusForbidden, Body: CloudflareBlockBody}
+	}
+	return Scenario{}
+}
+
+// ThinkingModelSuffix 上游思考模型的后缀,默认回显前会先输出一段 <think> 思考内容
+const ThinkingModelSuffix = "-et"
+
+// echoChunks 回显 query 中最后一条用户消息,前缀与消息各占一个数据块
+func echoChunks(query string) []string {
+	var messages []struct {
+		Role    string      `json:"role"`
+		Content interface{} `json:"content"`
+	}
+	text := query
+	if err := json.Unmarshal([]byte(query), &messages); err == nil {
+		for i := len(messages) - 1; i >= 0; i-- {
+			if messages[i].Role == "user" {
+				if content, ok := messages[i].Content.(string); ok {
+					text = content
+				} else {
+					contentBytes, _ := json.Marshal(messages[i].Content)
+					text = string(contentBytes)
+				}
+				break
+			}
+		}
+	}
+
+	return []string{"Mock reply:", text}
+}
+
+// writeStream 以 event-stream 格式逐块写出,多行数据块拆分为多个 data 字段。
+// 调用方提前断开时返回 false
+func writeStream(w http.ResponseWriter, r *http.Request, chunks []string, interval time.Duration) bool {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+
+	for i, chunk := range chunks {
+		if i > 0 && interval > 0 {
+			select {
+			case <-time.After(interval):
+			case <-r.Context().Done():
+				return false
+			}
+		}
+		var frame strings.Builder
+		for _, line := range strings.Split(chunk, "\n") {
+			frame.WriteString("data: ")
+			frame.WriteString(line)
+			frame.WriteString("\n")
+		}
+		frame.WriteString("\n")
+		if _, err := w.Write([]byte(frame.String())); err != nil {
+			return false
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	return true
+}
@@ -0,0 +1,92 @@
+package getbind_api
+
+import (
+	"fmt"
+	"getbind2api/common/config"
+	"getbind2api/cycletls"
+	"github.com/samber/lo"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+)
+
+// profileRandom FINGERPRINT_PROFILE 为 random 时每次请求随机选择浏览器指纹
+const profileRandom = "random"
+
+var (
+	benchedProfiles = map[string]time.Time{} // 被 Cloudflare 拦截而暂停使用的浏览器指纹
+	benchedMutex    sync.Mutex
+)
+
+// CheckFingerprintProfile 校验 FINGERPRINT_PROFILE 是否为已知的浏览器指纹
+func CheckFingerprintProfile() error {
+	if strings.EqualFold(config.FingerprintProfile, profileRandom) {
+		return nil
+	}
+	if _, ok := cycletls.GetProfile(config.FingerprintProfile); !ok {
+		return fmt.Errorf("unknown fingerprint profile %s, available: %s, %s", config.FingerprintProfile, profileRandom, strings.Join(cycletls.ProfileNames(), ", "))
+	}
+	return nil
+}
+
+// selectProfile 返回本次请求使用的浏览器指纹,账号单独设置的指纹优先,其次为 FINGERPRINT_PROFILE。
+// 选中的指纹暂停使用中或在 excluded 中时,随机换用其他指纹
+func selectProfile(cookie string, excluded ...string) cycletls.Profile {
+	name := config.CookieProfile(cookie)
+	if name == "" {
+		name = config.FingerprintProfile
+	}
+
+	profile, ok := cycletls.GetProfile(name)
+	if strings.EqualFold(name, profileRandom) {
+		ok = false
+	} else if !ok {
+		profile, ok = cycletls.GetProfile(cycletls.DefaultProfile)
+	}
+	if ok && !lo.Contains(excluded, profile.Name) && !profileBenched(profile.Name) {
+		return profile
+	}
+
+	var healthy, available []string
+	for _, candidate := range cycletls.ProfileNames() {
+		if lo.Contains(excluded, candidate) {
+			continue
+		}
+		available = append(available, candidate)
+		if !profileBenched(candidate) {
+			healthy = append(healthy, candidate)
+		}
+	}
+	candidates := healthy
+	if len(candidates) == 0 {
+		candidates = available
+	}
+	if len(candidates) == 0 {
+		if ok {
+			return profile
+		}
+		return cycletls.RandomProfile()
+	}
+	profile, _ = cycletls.GetProfile(candidates[rand.Intn(len(candidates))])
+	return profile
+}
+
+// benchProfile 暂停使用浏览器指纹 CLOUDFLARE_BENCH_DURATION 秒
+func benchProfile(name string) {
+	benchedMutex.Lock()
+	defer benchedMutex.Unlock()
+	benchedProfiles[name] = time.Now().Add(time.Duration(config.CloudflareBenchDuration) * time.Second)
+}
+
+func profileBenched(name string) bool {
+	benchedMutex.Lock()
+	defer benchedMutex.Unlock()
+
+	until, ok := benchedProfiles[name]
+	if ok && !until.After(time.Now()) {
+		delete(benchedProfiles, name)
+		return false
+	}
+	return ok
+}
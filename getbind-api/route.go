@@ -0,0 +1,123 @@
+package getbind_api
+
+import (
+	"context"
+	"errors"
+	"getbind2api/common"
+	"getbind2api/common/config"
+	logger "getbind2api/common/loggger"
+	"getbind2api/cycletls"
+	"github.com/samber/lo"
+)
+
+// ErrUpstreamBlocked 请求被 Cloudflare 拦截或要求人机验证
+var ErrUpstreamBlocked = errors.New("request blocked by Cloudflare")
+
+// IsUpstreamBlocked 判断上游返回的是否为 Cloudflare 拦截页或验证页
+func IsUpstreamBlocked(data string) bool {
+	return common.IsCloudflareBlock(data) || common.IsCloudflareChallenge(data)
+}
+
+// Route 请求上游使用的代理与浏览器指纹
+type Route struct {
+	Proxy   string // 为空时直连
+	Profile cycletls.Profile
+}
+
+func (r Route) String() string {
+	proxy := "direct"
+	if r.Proxy != "" {
+		proxy = config.RedactProxyUrl(r.Proxy)
+	}
+	return proxy + "/" + r.Profile.Name
+}
+
+// Routes 记录一次对话请求中被 Cloudflare 拦截的路线,重试时避开。为nil时只按全局的暂停状态选择路线
+type Routes struct {
+	Current         Route
+	blockedProxies  []string
+	blockedProfiles []string
+	blocks          int
+}
+
+// next 为账号选择代理与浏览器指纹,跳过本次请求中已被拦截的代理与指纹
+func (r *Routes) next(cookie string) Route {
+	if r == nil {
+		return Route{Proxy: config.SelectProxy(cookie), Profile: selectProfile(cookie)}
+	}
+	r.Current = Route{
+		Proxy:   config.SelectProxy(cookie, r.blockedProxies...),
+		Profile: selectProfile(cookie, r.blockedProfiles...),
+	}
+	return r.Current
+}
+
+// Block 记录当前路线被拦截:使用代理时换用其他代理,直连时换用其他浏览器指纹。
+// 超过 CLOUDFLARE_MAX_RETRIES 次或已没有其他路线时返回 false
+func (r *Routes) Block() bool {
+	r.blocks++
+	if r.Current.Proxy != "" {
+		if !lo.Contains(r.blockedProxies, r.Current.Proxy) {
+			r.blockedProxies = append(r.blockedProxies, r.Current.Proxy)
+		}
+	} else if !lo.Contains(r.blockedProfiles, r.Current.Profile.Name) {
+		r.blockedProfiles = append(r.blockedProfiles, r.Current.Profile.Name)
+	}
+
+	if r.blocks > config.CloudflareMaxRetries {
+		return false
+	}
+	if r.Current.Proxy != "" {
+		return len(r.blockedProxies) < config.ProxyCount()
+	}
+	return len(r.blockedProfiles) < len(cycletls.ProfileNames())
+}
+
+// Blocks 本次请求被拦截的次数
+func (r *Routes) Blocks() int {
+	return r.blocks
+}
+
+// benchRoute 暂停使用被拦截的路线:使用代理时暂停该代理,直连时暂停该浏览器指纹
+func benchRoute(ctx context.Context, route Route, message string) {
+	if route.Proxy != "" {
+		config.BenchProxy(route.Proxy, message, config.CloudflareBenchDuration)
+	} else {
+		benchProfile(route.Profile.Name)
+	}
+	logger.Warnf(ctx, "Blocked by Cloudflare, route benched for %ds, ROUTE:%s", config.CloudflareBenchDuration, route)
+}
+
+// reportRouteResult 被动记录路线的健康状态,连接失败达到阈值的代理、被拦截的代理或指纹会被暂停使用
+func reportRouteResult(ctx context.Context, route Route, connError bool, message string) {
+	switch {
+	case IsUpstreamBlocked(message):
+		benchRoute(ctx, route, message)
+	case route.Proxy == "":
+	case !connError:
+		config.ReportProxySuccess(route.Proxy)
+	case config.ReportProxyFailure(route.Proxy, message):
+		logger.Warnf(ctx, "Proxy benched for %ds after repeated failures, PROXY:%s", config.ProxyBenchDuration, config.RedactProxyUrl(route.Proxy))
+	}
+}
+
+// trackRouteHealth 转发上游响应,并根据首个响应记录路线的健康状态
+func trackRouteHealth(ctx context.Context, route Route, sseChan <-chan cycletls.SSEResponse) <-chan cycletls.SSEResponse {
+	out := make(chan cycletls.SSEResponse)
+	go func() {
+		defer close(out)
+		reported := false
+		for response := range sseChan {
+			if !reported {
+				reported = true
+				reportRouteResult(ctx, route, response.ConnError, response.Data)
+			}
+			select {
+			case out <- response:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
@@ -10,18 +10,27 @@ import (
 	"getbind2api/common"
 	"getbind2api/common/config"
 	logger "getbind2api/common/loggger"
+	"getbind2api/getbind-api"
+	"getbind2api/getbind-api/mock"
 	"getbind2api/middleware"
 	"getbind2api/model"
 	"getbind2api/router"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 //var buildFS embed.FS
 
+// pendingWritesFlushInterval API-KEY用量与请求日志写入数据库的间隔
+const pendingWritesFlushInterval = 5 * time.Second
+
 func main() {
+	common.ParseFlags()
 	logger.SetupLogger()
 	logger.SysLog(fmt.Sprintf("getbind2api %s starting...", common.Version))
 
@@ -33,8 +42,41 @@ func main() {
 
 	var err error
 
+	if *common.MockUpstream {
+		_, baseUrl, err := mock.Start(config.MockUpstreamAddr)
+		if err != nil {
+			logger.FatalLog("failed to start mock upstream: " + err.Error())
+		}
+		config.UpstreamBaseUrl = baseUrl
+		config.UpstreamChatUrl = ""
+		logger.SysLog("mock upstream listening on " + baseUrl)
+	}
+
+	if err = common.LoadModelRegistry(); err != nil {
+		logger.FatalLog("failed to load model registry: " + err.Error())
+	}
+	resolveApiKeyModels()
 	model.InitTokenEncoders()
-	config.InitSGCookies()
+	reloadModelsOnSignal()
+	if err = config.InitDB(); err != nil {
+		logger.FatalLog("failed to init database: " + err.Error())
+	}
+	defer config.CloseDB()
+	startRequestLogCleanup()
+	if err = config.InitSGCookies(); err != nil {
+		logger.FatalLog("failed to load cookie pool: " + err.Error())
+	}
+	if err = config.InitApiKeys(); err != nil {
+		logger.FatalLog("failed to load api keys: " + err.Error())
+	}
+	startPendingWritesFlush()
+	if err = config.InitProxyPool(); err != nil {
+		logger.FatalLog("failed to load proxies: " + err.Error())
+	}
+	if err = getbind_api.CheckFingerprintProfile(); err != nil {
+		logger.FatalLog(err.Error())
+	}
+	getbind_api.StartHealthCheck()
 
 	server := gin.New()
 	server.Use(gin.Recovery())
@@ -63,3 +105,79 @@ func main() {
 		logger.FatalLog("failed to start HTTP server: " + err.Error())
 	}
 }
+
+// resolveApiKeyModels 将 API_KEY_MODELS 中的别名统一为对外的模型名
+func resolveApiKeyModels() {
+	unknown := config.ResolveApiKeyModels(func(modelName string) (string, bool) {
+		modelInfo, ok := common.GetModelInfo(modelName)
+		return modelInfo.Id, ok
+	})
+	for _, modelName := range unknown {
+		logger.SysError("API_KEY_MODELS: model " + modelName + " not supported")
+	}
+}
+
+// reloadModelsOnSignal 收到 SIGHUP 时重新加载模型配置文件并刷新token编码器
+func reloadModelsOnSignal() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			if err := common.LoadModelRegistry(); err != nil {
+				logger.SysError("failed to reload model registry: " + err.Error())
+				continue
+			}
+			resolveApiKeyModels()
+			model.InitTokenEncoders()
+			logger.SysLog(fmt.Sprintf("model registry reloaded, %d models", len(common.GetModelList())))
+		}
+	}()
+}
+
+// startPendingWritesFlush 定期将API-KEY用量与请求日志批量写入数据库,退出时写入剩余的数据
+func startPendingWritesFlush() {
+	go func() {
+		ticker := time.NewTicker(pendingWritesFlushInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			flushPendingWrites()
+		}
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		flushPendingWrites()
+		config.CloseDB()
+		os.Exit(0)
+	}()
+}
+
+func flushPendingWrites() {
+	if err := config.FlushApiKeyUsage(); err != nil {
+		logger.SysError("failed to flush api key usage: " + err.Error())
+	}
+	if err := config.FlushRequestLogs(); err != nil {
+		logger.SysError("failed to flush request logs: " + err.Error())
+	}
+}
+
+// startRequestLogCleanup 每天删除一次超过 REQUEST_LOG_RETENTION_DAYS 的请求日志
+func startRequestLogCleanup() {
+	if config.RequestLogRetentionDays <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(24 * time.Hour)
+		defer ticker.Stop()
+		for {
+			if deleted, err := config.CleanupRequestLogs(); err != nil {
+				logger.SysError("failed to cleanup request logs: " + err.Error())
+			} else if deleted > 0 {
+				logger.SysLog(fmt.Sprintf("cleaned up %d request logs", deleted))
+			}
+			<-ticker.C
+		}
+	}()
+}
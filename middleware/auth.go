@@ -3,6 +3,7 @@ package middleware
 import (
 	"getbind2api/common"
 	"getbind2api/common/config"
+	"getbind2api/common/helper"
 	logger "getbind2api/common/loggger"
 	"getbind2api/model"
 	"github.com/gin-gonic/gin"
@@ -11,14 +12,26 @@ import (
 	"strings"
 )
 
+// isValidSecret 未设置 API_SECRET 且未创建API-KEY时不校验
 func isValidSecret(secret string) bool {
 	if config.ApiSecret == "" {
-		return true
+		return !config.HasApiKeys()
 	} else {
 		return lo.Contains(config.ApiSecrets, secret)
 	}
 }
 
+func abortWithOpenAIError(c *gin.Context, statusCode int, message, code string) {
+	c.JSON(statusCode, model.OpenAIErrorResponse{
+		OpenAIError: model.OpenAIError{
+			Message: message,
+			Type:    "invalid_request_error",
+			Code:    code,
+		},
+	})
+	c.Abort()
+}
+
 func isValidBackendSecret(secret string) bool {
 	return config.BackendSecret != "" && !(config.BackendSecret == secret)
 }
@@ -26,21 +39,31 @@ func isValidBackendSecret(secret string) bool {
 func authHelperForOpenai(c *gin.Context) {
 	secret := c.Request.Header.Get("Authorization")
 	secret = strings.Replace(secret, "Bearer ", "", 1)
+	// Anthropic 客户端通过 x-api-key 传递密钥
+	if secret == "" {
+		secret = c.Request.Header.Get("x-api-key")
+	}
 
-	b := isValidSecret(secret)
-
-	if !b {
-		c.JSON(http.StatusUnauthorized, model.OpenAIErrorResponse{
-			OpenAIError: model.OpenAIError{
-				Message: "API-KEY校验失败",
-				Type:    "invalid_request_error",
-				Code:    "invalid_authorization",
-			},
-		})
-		c.Abort()
+	// 通过管理接口创建的API-KEY需检查禁用、过期与每分钟请求数
+	if info, ok := config.LookupApiKey(secret); ok {
+		switch {
+		case info.Disabled:
+			abortWithOpenAIError(c, http.StatusUnauthorized, "API-KEY已禁用", "invalid_authorization")
+			return
+		case info.Expired():
+			abortWithOpenAIError(c, http.StatusUnauthorized, "API-KEY已过期", "api_key_expired")
+			return
+		case !config.AllowApiKeyRequest(info.Id, info.RateLimit):
+			abortWithOpenAIError(c, http.StatusTooManyRequests, "API-KEY请求过于频繁", "rate_limit_exceeded")
+			return
+		}
+	} else if !isValidSecret(secret) {
+		abortWithOpenAIError(c, http.StatusUnauthorized, "API-KEY校验失败", "invalid_authorization")
 		return
 	}
 
+	c.Set(helper.ApiKeyIdKey, config.ApiKeyId(secret))
+
 	//if config.ApiSecret == "" {
 	//	c.Request.Header.Set("Authorization", "")
 	//}
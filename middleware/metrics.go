@@ -0,0 +1,15 @@
+package middleware
+
+import (
+	"getbind2api/common/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics 统计对话请求的数量与耗时,模型与流式模式由接口通过 metrics.SetRequestLabels 记录
+func Metrics() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		metrics.StartRequest(c)
+		c.Next()
+		metrics.ObserveRequest(c, c.Writer.Status())
+	}
+}
@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"getbind2api/common/config"
+	"getbind2api/common/helper"
+	"getbind2api/common/metrics"
+	"github.com/gin-gonic/gin"
+	"time"
+)
+
+// RequestLog 在对话请求结束后记录请求日志,模型与token数由接口记录在 gin.Context 中
+func RequestLog() func(c *gin.Context) {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		if config.RequestLogEnable != 1 {
+			return
+		}
+		modelName, stream := metrics.RequestModel(c)
+		config.AddRequestLog(config.RequestLog{
+			RequestId:        c.GetString(helper.RequestIdKey),
+			KeyId:            c.GetString(helper.ApiKeyIdKey),
+			Model:            modelName,
+			Stream:           stream,
+			StatusCode:       c.Writer.Status(),
+			Cookie:           c.GetString(helper.CookieKey),
+			PromptTokens:     c.GetInt(helper.PromptTokensKey),
+			CompletionTokens: c.GetInt(helper.CompletionTokensKey),
+			DurationMs:       time.Since(start).Milliseconds(),
+			ClientIp:         c.ClientIP(),
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package model
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+)
+
+// ClaudeSystemPrompt 兼容 Anthropic system 字段的字符串与数组两种写法
+type ClaudeSystemPrompt []ClaudeSystemMessage
+
+func (p *ClaudeSystemPrompt) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		*p = ClaudeSystemPrompt{{Type: "text", Text: text}}
+		return nil
+	}
+	var messages []ClaudeSystemMessage
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return err
+	}
+	*p = messages
+	return nil
+}
+
+// Text 返回拼接后的system文本
+func (p ClaudeSystemPrompt) Text() string {
+	var texts []string
+	for _, message := range p {
+		if message.Text != "" {
+			texts = append(texts, message.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+type ClaudeMessagesResponse struct {
+	ID           string               `json:"id"`
+	Type         string               `json:"type"`
+	Role         string               `json:"role"`
+	Model        string               `json:"model"`
+	Content      []ClaudeContentBlock `json:"content"`
+	StopReason   *string              `json:"stop_reason"`
+	StopSequence *string              `json:"stop_sequence"`
+	Usage        ClaudeUsage          `json:"usage"`
+}
+
+type ClaudeContentBlock struct {
+	Type     string `json:"type"`
+	Text     string `json:"text"`
+	Thinking string `json:"thinking"`
+}
+
+// MarshalJSON 按内容块类型只输出对应字段
+func (b ClaudeContentBlock) MarshalJSON() ([]byte, error) {
+	if b.Type == "thinking" {
+		return json.Marshal(struct {
+			Type     string `json:"type"`
+			Thinking string `json:"thinking"`
+		}{b.Type, b.Thinking})
+	}
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}{b.Type, b.Text})
+}
+
+type ClaudeUsage struct {
+	InputTokens  int `json:"input_tokens"`
+	OutputTokens int `json:"output_tokens"`
+}
+
+// ClaudeStreamEvent Anthropic 流式事件,按事件类型填充对应字段
+type ClaudeStreamEvent struct {
+	Type         string                  `json:"type"`
+	Message      *ClaudeMessagesResponse `json:"message,omitempty"`
+	Index        *int                    `json:"index,omitempty"`
+	ContentBlock *ClaudeContentBlock     `json:"content_block,omitempty"`
+	Delta        interface{}             `json:"delta,omitempty"`
+	Usage        *ClaudeUsage            `json:"usage,omitempty"`
+	Error        *ClaudeError            `json:"error,omitempty"`
+}
+
+type ClaudeTextDelta struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type ClaudeThinkingDelta struct {
+	Type     string `json:"type"`
+	Thinking string `json:"thinking"`
+}
+
+type ClaudeMessageDelta struct {
+	StopReason   *string `json:"stop_reason"`
+	StopSequence *string `json:"stop_sequence"`
+}
+
+type ClaudeErrorResponse struct {
+	Type  string      `json:"type"`
+	Error ClaudeError `json:"error"`
+}
+
+type ClaudeError struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// ConvertClaudeToOpenAIRequest 将Anthropic Messages请求转换为OpenAI请求,复用同一套上游调用逻辑
+func ConvertClaudeToOpenAIRequest(claudeReq ClaudeCompletionRequest) OpenAIChatCompletionRequest {
+	openAIReq := OpenAIChatCompletionRequest{
+		Model:       claudeReq.Model,
+		Stream:      claudeReq.Stream,
+		MaxTokens:   claudeReq.MaxTokens,
+		Temperature: claudeReq.Temperature,
+	}
+
+	if system := claudeReq.System.Text(); system != "" {
+		openAIReq.Messages = append(openAIReq.Messages, OpenAIChatMessage{
+			Role:    "system",
+			Content: system,
+		})
+	}
+
+	for _, msg := range claudeReq.Messages {
+		openAIReq.Messages = append(openAIReq.Messages, OpenAIChatMessage{
+			Role:    msg.Role,
+			Content: convertClaudeContent(msg.Content),
+		})
+	}
+
+	return openAIReq
+}
+
+func convertClaudeContent(content interface{}) interface{} {
+	blocks, ok := content.([]interface{})
+	if !ok {
+		return content
+	}
+
+	var openAIContent []interface{}
+	for _, block := range blocks {
+		blockMap, ok := block.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		blockType, _ := blockMap["type"].(string)
+		switch blockType {
+		case "text":
+			text, _ := blockMap["text"].(string)
+			openAIContent = append(openAIContent, map[string]interface{}{
+				"type": "text",
+				"text": text,
+			})
+		case "image":
+			source, _ := blockMap["source"].(map[string]interface{})
+			url := ""
+			switch source["type"] {
+			case "base64":
+				mediaType, _ := source["media_type"].(string)
+				data, _ := source["data"].(string)
+				url = "data:" + mediaType + ";base64," + data
+			case "url":
+				url, _ = source["url"].(string)
+			}
+			if url != "" {
+				openAIContent = append(openAIContent, map[string]interface{}{
+					"type":      "image_url",
+					"image_url": map[string]interface{}{"url": url},
+				})
+			}
+		case "document":
+			// 转换为OpenAI格式的 file 内容块,与 file 内容块走相同的上传流程
+			source, _ := blockMap["source"].(map[string]interface{})
+			fileData := ""
+			switch source["type"] {
+			case "base64":
+				mediaType, _ := source["media_type"].(string)
+				data, _ := source["data"].(string)
+				fileData = "data:" + mediaType + ";base64," + data
+			case "text":
+				data, _ := source["data"].(string)
+				fileData = "data:text/plain;base64," + base64.StdEncoding.EncodeToString([]byte(data))
+			case "url":
+				fileData, _ = source["url"].(string)
+			}
+			filename, _ := blockMap["title"].(string)
+			openAIContent = append(openAIContent, map[string]interface{}{
+				"type": "file",
+				"file": map[string]interface{}{
+					"filename":  filename,
+					"file_data": fileData,
+				},
+			})
+		default:
+			// 其他类型的内容块按JSON文本传递
+			blockBytes, err := json.Marshal(blockMap)
+			if err != nil {
+				continue
+			}
+			openAIContent = append(openAIContent, map[string]interface{}{
+				"type": "text",
+				"text": string(blockBytes),
+			})
+		}
+	}
+	return openAIContent
+}
@@ -0,0 +1,149 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// 上下文裁剪策略
+const (
+	ContextTrimNone       = ""            // 不检查提示词长度
+	ContextTrimReject     = "reject"      // 超出上下文窗口时直接返回错误
+	ContextTrimDropOldest = "drop_oldest" // 丢弃最早的对话,保留system消息
+	ContextTrimSummarize  = "summarize"   // 将最早的对话压缩为一条摘要system消息
+)
+
+// summaryMessageRunes 摘要中每条被裁剪消息保留的最大字符数
+const summaryMessageRunes = 200
+
+const summaryPrefix = "Summary of the earlier conversation (older turns were trimmed to fit the context window):"
+
+// ContextTrimResult 裁剪结果
+type ContextTrimResult struct {
+	TrimmedMessages int // 被裁剪的消息数
+	TrimmedTokens   int // 裁剪掉的token数(已扣除摘要的token数)
+	PromptTokens    int // 裁剪后的提示词token数
+}
+
+// TrimMessages 在提示词超出 budget 时按策略裁剪最早的对话,
+// system消息与最后一条user消息及其之后的消息始终保留。裁剪后仍超出时返回错误
+func (r *OpenAIChatCompletionRequest) TrimMessages(strategy string, budget int) (ContextTrimResult, error) {
+	var result ContextTrimResult
+	if strategy == ContextTrimNone {
+		return result, nil
+	}
+
+	promptTokens := r.CountPromptTokens()
+	result.PromptTokens = promptTokens
+	if promptTokens <= budget {
+		return result, nil
+	}
+	if strategy == ContextTrimReject {
+		return result, fmt.Errorf("prompt is %d tokens, exceeding the context budget of %d tokens", promptTokens, budget)
+	}
+
+	// 工具提示词等额外开销按裁剪前的差值估算
+	overhead := promptTokens - CountTokenMessages(r.Messages, r.Model)
+
+	lastUser := len(r.Messages)
+	for i := len(r.Messages) - 1; i >= 0; i-- {
+		if r.Messages[i].Role == "user" {
+			lastUser = i
+			break
+		}
+	}
+
+	messageTokens := make([]int, len(r.Messages))
+	total := 3 + overhead
+	for i, msg := range r.Messages {
+		messageTokens[i] = CountTokenMessages([]OpenAIChatMessage{msg}, r.Model) - 3
+		total += messageTokens[i]
+	}
+
+	dropped := make([]bool, len(r.Messages))
+	var droppedMessages []OpenAIChatMessage
+	var summary *OpenAIChatMessage
+	next := 0
+	for {
+		current := total
+		if summary != nil {
+			current += CountTokenMessages([]OpenAIChatMessage{*summary}, r.Model) - 3
+		}
+		if current <= budget {
+			break
+		}
+
+		// 丢弃下一条最早的非system消息,其后紧跟的tool结果一并丢弃
+		for next < lastUser && r.Messages[next].Role == "system" {
+			next++
+		}
+		if next >= lastUser {
+			return result, fmt.Errorf("prompt is %d tokens after trimming, exceeding the context budget of %d tokens", current, budget)
+		}
+		for {
+			dropped[next] = true
+			droppedMessages = append(droppedMessages, r.Messages[next])
+			total -= messageTokens[next]
+			next++
+			if next >= lastUser || r.Messages[next].Role != "tool" {
+				break
+			}
+		}
+
+		if strategy == ContextTrimSummarize {
+			summary = summarizeMessages(droppedMessages)
+		}
+	}
+
+	var messages []OpenAIChatMessage
+	summaryInserted := summary == nil
+	for i, msg := range r.Messages {
+		if dropped[i] {
+			continue
+		}
+		// 摘要放在开头的system消息之后
+		if !summaryInserted && msg.Role != "system" {
+			messages = append(messages, *summary)
+			summaryInserted = true
+		}
+		messages = append(messages, msg)
+	}
+	if !summaryInserted {
+		messages = append(messages, *summary)
+	}
+	r.Messages = messages
+
+	result.TrimmedMessages = len(droppedMessages)
+	result.PromptTokens = r.CountPromptTokens()
+	result.TrimmedTokens = promptTokens - result.PromptTokens
+	return result, nil
+}
+
+// CountPromptTokens 按实际发往上游的消息(含预置消息与工具提示词)统计提示词token数
+func (r *OpenAIChatCompletionRequest) CountPromptTokens() int {
+	messages, err := r.BuildToolMessages()
+	if err != nil {
+		messages = r.Messages
+	}
+	return CountTokenMessages(messages, r.Model)
+}
+
+// summarizeMessages 将被裁剪的消息压缩为一条system消息,每条消息只保留开头部分
+func summarizeMessages(messages []OpenAIChatMessage) *OpenAIChatMessage {
+	var sb strings.Builder
+	sb.WriteString(summaryPrefix)
+	for _, msg := range messages {
+		text := []rune(strings.Join(strings.Fields(contentToString(msg.Content)), " "))
+		for _, call := range msg.ToolCalls {
+			text = append(text, []rune(" "+formatToolCall(call))...)
+		}
+		if len(text) > summaryMessageRunes {
+			text = append(text[:summaryMessageRunes], []rune("...")...)
+		}
+		sb.WriteString(fmt.Sprintf("\n- %s: %s", msg.Role, string(text)))
+	}
+	return &OpenAIChatMessage{
+		Role:    "system",
+		Content: sb.String(),
+	}
+}
@@ -8,27 +8,65 @@ import (
 )
 
 type OpenAIChatCompletionRequest struct {
-	Model       string              `json:"model"`
-	Stream      bool                `json:"stream"`
-	Messages    []OpenAIChatMessage `json:"messages"`
-	MaxTokens   int                 `json:"max_tokens"`
-	Temperature float64             `json:"temperature"`
+	Model         string               `json:"model"`
+	Stream        bool                 `json:"stream"`
+	Messages      []OpenAIChatMessage  `json:"messages"`
+	MaxTokens     int                  `json:"max_tokens"`
+	Temperature   float64              `json:"temperature"`
+	Tools         []OpenAITool         `json:"tools,omitempty"`
+	ToolChoice    interface{}          `json:"tool_choice,omitempty"`
+	StreamOptions *OpenAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type OpenAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
+}
+
+// IncludeUsage 流式请求是否需要在结束前返回用量
+func (r *OpenAIChatCompletionRequest) IncludeUsage() bool {
+	return r.Stream && r.StreamOptions != nil && r.StreamOptions.IncludeUsage
 }
 
 type OpenAIChatMessage struct {
-	Role    string      `json:"role"`
-	Content interface{} `json:"content"`
+	Role       string           `json:"role"`
+	Content    interface{}      `json:"content"`
+	Name       string           `json:"name,omitempty"`
+	ToolCalls  []OpenAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallId string           `json:"tool_call_id,omitempty"`
+}
+
+type OpenAITool struct {
+	Type     string         `json:"type"`
+	Function OpenAIFunction `json:"function"`
+}
+
+type OpenAIFunction struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  interface{} `json:"parameters,omitempty"`
+}
+
+type OpenAIToolCall struct {
+	Index    *int               `json:"index,omitempty"` // 仅在流式delta中返回
+	ID       string             `json:"id,omitempty"`
+	Type     string             `json:"type,omitempty"`
+	Function OpenAIFunctionCall `json:"function"`
+}
+
+type OpenAIFunctionCall struct {
+	Name      string `json:"name,omitempty"`
+	Arguments string `json:"arguments"`
 }
 
 // 修正后的Claude请求结构
 type ClaudeCompletionRequest struct {
-	Model       string                `json:"model"`
-	MaxTokens   int                   `json:"max_tokens"`
-	Temperature float64               `json:"temperature"`
-	System      []ClaudeSystemMessage `json:"system,omitempty"`
-	Messages    []ClaudeMessage       `json:"messages,omitempty"`
-	Stream      bool                  `json:"stream,omitempty"`
-	Thinking    *ClaudeThinking       `json:"thinking,omitempty"`
+	Model       string             `json:"model"`
+	MaxTokens   int                `json:"max_tokens"`
+	Temperature float64            `json:"temperature"`
+	System      ClaudeSystemPrompt `json:"system,omitempty"`
+	Messages    []ClaudeMessage    `json:"messages,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+	Thinking    *ClaudeThinking    `json:"thinking,omitempty"`
 }
 
 // 单独定义 Thinking 结构体
@@ -272,7 +310,7 @@ func ConvertOpenAIToClaudeRequest(openAIReq OpenAIChatCompletionRequest, modelIn
 
 	if len(systemMessages) == 0 {
 		systemMessages = append(systemMessages, ClaudeSystemMessage{
-			Text: fmt.Sprintf(kiloSystemPrompt),
+			Text: kiloSystemPrompt,
 			Type: "text",
 			CacheControl: struct {
 				Type string `json:"type"`
@@ -489,7 +527,7 @@ type OpenAIChatCompletionResponse struct {
 	Created           int64          `json:"created"`
 	Model             string         `json:"model"`
 	Choices           []OpenAIChoice `json:"choices"`
-	Usage             OpenAIUsage    `json:"usage"`
+	Usage             *OpenAIUsage   `json:"usage,omitempty"`
 	SystemFingerprint *string        `json:"system_fingerprint"`
 	Suggestions       []string       `json:"suggestions"`
 }
@@ -503,8 +541,10 @@ type OpenAIChoice struct {
 }
 
 type OpenAIMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role             string           `json:"role"`
+	Content          string           `json:"content"`
+	ReasoningContent string           `json:"reasoning_content,omitempty"`
+	ToolCalls        []OpenAIToolCall `json:"tool_calls,omitempty"`
 }
 
 type OpenAIUsage struct {
@@ -514,8 +554,10 @@ type OpenAIUsage struct {
 }
 
 type OpenAIDelta struct {
-	Content string `json:"content"`
-	Role    string `json:"role"`
+	Content          string           `json:"content"`
+	ReasoningContent string           `json:"reasoning_content,omitempty"`
+	Role             string           `json:"role"`
+	ToolCalls        []OpenAIToolCall `json:"tool_calls,omitempty"`
 }
 
 type OpenAIImagesGenerationRequest struct {
@@ -565,10 +607,26 @@ type OpenAIModerationResponse struct {
 }
 
 type OpenaiModelResponse struct {
-	ID     string `json:"id"`
-	Object string `json:"object"`
-	//Created time.Time `json:"created"`
-	//OwnedBy string    `json:"owned_by"`
+	ID            string                   `json:"id"`
+	Object        string                   `json:"object"`
+	Created       int64                    `json:"created"`
+	OwnedBy       string                   `json:"owned_by"`
+	ContextLength int                      `json:"context_length"`
+	Aliases       []string                 `json:"aliases,omitempty"`
+	Capabilities  common.ModelCapabilities `json:"capabilities"`
+}
+
+// NewOpenaiModelResponse 由模型信息生成 /v1/models 中的模型对象
+func NewOpenaiModelResponse(modelInfo common.ModelInfo) OpenaiModelResponse {
+	return OpenaiModelResponse{
+		ID:            modelInfo.Id,
+		Object:        "model",
+		Created:       modelInfo.Created,
+		OwnedBy:       modelInfo.OwnedBy,
+		ContextLength: modelInfo.MaxTokens,
+		Aliases:       modelInfo.Aliases,
+		Capabilities:  modelInfo.Capabilities,
+	}
 }
 
 // ModelList represents a list of models.
@@ -637,6 +695,12 @@ func (r *OpenAIChatCompletionRequest) RemoveEmptyContentMessages() *OpenAIChatCo
 
 	var filteredMessages []OpenAIChatMessage
 	for _, msg := range r.Messages {
+		// 带有tool_calls的assistant消息content可以为空
+		if len(msg.ToolCalls) > 0 {
+			filteredMessages = append(filteredMessages, msg)
+			continue
+		}
+
 		// Check if content is nil
 		if msg.Content == nil {
 			continue
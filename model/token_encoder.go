@@ -6,22 +6,25 @@ import (
 	"getbind2api/common"
 	logger "getbind2api/common/loggger"
 	"github.com/pkoukk/tiktoken-go"
+	"math"
 
 	//"getbind2api/model"
 	"strings"
+	"sync"
 )
 
-// tokenEncoderMap won't grow after initialization
+// tokenEncoderMap 在模型列表重新加载时整体替换
 var tokenEncoderMap = map[string]*tiktoken.Tiktoken{}
+var tokenEncoderMu sync.RWMutex
 var defaultTokenEncoder *tiktoken.Tiktoken
 
+// InitTokenEncoders 为模型列表中的模型及其别名初始化编码器,模型列表重新加载后需再次调用
 func InitTokenEncoders() {
 	logger.SysLog("initializing token encoders...")
 	gpt35TokenEncoder, err := tiktoken.EncodingForModel("gpt-3.5-turbo")
 	if err != nil {
 		logger.FatalLog(fmt.Sprintf("failed to get gpt-3.5-turbo token encoder: %s", err.Error()))
 	}
-	defaultTokenEncoder = gpt35TokenEncoder
 	gpt4oTokenEncoder, err := tiktoken.EncodingForModel("gpt-4o")
 	if err != nil {
 		logger.FatalLog(fmt.Sprintf("failed to get gpt-4o token encoder: %s", err.Error()))
@@ -30,22 +33,38 @@ func InitTokenEncoders() {
 	if err != nil {
 		logger.FatalLog(fmt.Sprintf("failed to get gpt-4 token encoder: %s", err.Error()))
 	}
+	encoders := map[string]*tiktoken.Tiktoken{}
 	for _, model := range common.GetModelList() {
 		if strings.HasPrefix(model, "gpt-3.5") {
-			tokenEncoderMap[model] = gpt35TokenEncoder
+			encoders[model] = gpt35TokenEncoder
 		} else if strings.HasPrefix(model, "gpt-4o") {
-			tokenEncoderMap[model] = gpt4oTokenEncoder
+			encoders[model] = gpt4oTokenEncoder
 		} else if strings.HasPrefix(model, "gpt-4") {
-			tokenEncoderMap[model] = gpt4TokenEncoder
+			encoders[model] = gpt4TokenEncoder
+		} else if isClaudeModel(model) {
+			// Claude 的分词器未公开,以 cl100k 编码为基础估算
+			encoders[model] = gpt4TokenEncoder
 		} else {
-			tokenEncoderMap[model] = nil
+			encoders[model] = nil
 		}
 	}
+	// 别名使用对应模型的编码器
+	for alias, model := range common.GetModelAliases() {
+		encoders[alias] = encoders[model]
+	}
+
+	tokenEncoderMu.Lock()
+	defer tokenEncoderMu.Unlock()
+	defaultTokenEncoder = gpt35TokenEncoder
+	tokenEncoderMap = encoders
 	logger.SysLog("token encoders initialized.")
 }
 
 func getTokenEncoder(model string) *tiktoken.Tiktoken {
+	tokenEncoderMu.RLock()
 	tokenEncoder, ok := tokenEncoderMap[model]
+	defaultEncoder := defaultTokenEncoder
+	tokenEncoderMu.RUnlock()
 	if ok && tokenEncoder != nil {
 		return tokenEncoder
 	}
@@ -53,18 +72,36 @@ func getTokenEncoder(model string) *tiktoken.Tiktoken {
 		tokenEncoder, err := tiktoken.EncodingForModel(model)
 		if err != nil {
 			//logger.SysError(fmt.Sprintf("[IGNORE] | failed to get token encoder for model %s: %s, using encoder for gpt-3.5-turbo", model, err.Error()))
-			tokenEncoder = defaultTokenEncoder
+			tokenEncoder = defaultEncoder
 		}
+		tokenEncoderMu.Lock()
 		tokenEncoderMap[model] = tokenEncoder
+		tokenEncoderMu.Unlock()
 		return tokenEncoder
 	}
-	return defaultTokenEncoder
+	return defaultEncoder
 }
 
 func getTokenNum(tokenEncoder *tiktoken.Tiktoken, text string) int {
 	return len(tokenEncoder.Encode(text, nil, nil))
 }
 
+// claudeTokenRatio Claude 分词结果通常比 cl100k 多出约一成,按比例放大估算
+const claudeTokenRatio = 1.1
+
+func isClaudeModel(model string) bool {
+	return strings.HasPrefix(model, "claude")
+}
+
+// getModelTokenNum 按模型统计文本token数,Claude 模型在 cl100k 结果上按比例估算
+func getModelTokenNum(tokenEncoder *tiktoken.Tiktoken, text string, model string) int {
+	tokenNum := getTokenNum(tokenEncoder, text)
+	if isClaudeModel(model) {
+		return int(math.Ceil(float64(tokenNum) * claudeTokenRatio))
+	}
+	return tokenNum
+}
+
 func CountTokenMessages(messages []OpenAIChatMessage, model string) int {
 	tokenEncoder := getTokenEncoder(model)
 	// Reference:
@@ -83,25 +120,25 @@ func CountTokenMessages(messages []OpenAIChatMessage, model string) int {
 		tokenNum += tokensPerMessage
 		switch v := message.Content.(type) {
 		case string:
-			tokenNum += getTokenNum(tokenEncoder, v)
+			tokenNum += getModelTokenNum(tokenEncoder, v, model)
 		case []any:
 			for _, it := range v {
-				m := it.(map[string]any)
+				m, ok := it.(map[string]any)
+				if !ok {
+					continue
+				}
 				switch m["type"] {
 				case "text":
 					if textValue, ok := m["text"]; ok {
 						if textString, ok := textValue.(string); ok {
-							tokenNum += getTokenNum(tokenEncoder, textString)
+							tokenNum += getModelTokenNum(tokenEncoder, textString, model)
 						}
 					}
 				case "image_url":
 					imageUrl, ok := m["image_url"].(map[string]any)
 					if ok {
-						url := imageUrl["url"].(string)
-						detail := ""
-						if imageUrl["detail"] != nil {
-							detail = imageUrl["detail"].(string)
-						}
+						url, _ := imageUrl["url"].(string)
+						detail, _ := imageUrl["detail"].(string)
 						imageTokens, err := countImageTokens(url, detail, model)
 						if err != nil {
 							logger.SysError("error counting image tokens: " + err.Error())
@@ -113,6 +150,9 @@ func CountTokenMessages(messages []OpenAIChatMessage, model string) int {
 			}
 		}
 		tokenNum += getTokenNum(tokenEncoder, message.Role)
+		for _, call := range message.ToolCalls {
+			tokenNum += getModelTokenNum(tokenEncoder, call.Function.Name+call.Function.Arguments, model)
+		}
 	}
 	tokenNum += 3 // Every reply is primed with <|start|>assistant<|message|>
 	return tokenNum
@@ -126,6 +166,8 @@ const (
 	gpt4oMiniLowDetailCost  = 2833
 	gpt4oMiniHighDetailCost = 5667
 	gpt4oMiniAdditionalCost = 2833
+	// Claude 按 宽*高/750 计费,无法获取图片尺寸时按长边 1568px 的上限估算
+	claudeImageCost = 1600
 )
 
 // https://platform.openai.com/docs/guides/vision/calculating-costs
@@ -156,6 +198,10 @@ func countImageTokens(url string, detail string, model string) (_ int, err error
 	// The following image, which is 125x50, is still treated as high-res, taken
 	// 255 tokens in the response of non-stream chat completion api.
 	// https://upload.wikimedia.org/wikipedia/commons/1/10/18_Infantry_Division_Messina.jpg
+	if isClaudeModel(model) {
+		// https://docs.anthropic.com/en/docs/build-with-claude/vision#calculate-image-costs
+		return claudeImageCost, nil
+	}
 	if detail == "" || detail == "auto" {
 		// assume by test, not sure if this is correct
 		detail = "low"
@@ -187,7 +233,7 @@ func CountTokenInput(input any, model string) int {
 
 func CountTokenText(text string, model string) int {
 	tokenEncoder := getTokenEncoder(model)
-	return getTokenNum(tokenEncoder, text)
+	return getModelTokenNum(tokenEncoder, text, model)
 }
 
 func CountToken(text string) int {
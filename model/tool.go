@@ -0,0 +1,270 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"getbind2api/common"
+	"strings"
+)
+
+// 上游不支持原生工具调用,通过提示词约定以下标签格式来模拟
+const (
+	toolCallStartTag = "<tool_call>"
+	toolCallEndTag   = "</tool_call>"
+)
+
+const toolPromptTemplate = `You can call the following tools. To call a tool, reply with one or more blocks in exactly this format and nothing else:
+<tool_call>{"name": "<tool name>", "arguments": {<arguments as a JSON object>}}</tool_call>
+Tool results will be sent back to you inside <tool_result> blocks. If no tool is needed, answer the user directly without any <tool_call> block.
+%s
+Available tools (JSON schema):
+%s`
+
+// NeedToolPrompt 判断是否需要注入工具提示词
+func (r *OpenAIChatCompletionRequest) NeedToolPrompt() bool {
+	if len(r.Tools) == 0 {
+		return false
+	}
+	if choice, ok := r.ToolChoice.(string); ok && choice == "none" {
+		return false
+	}
+	return true
+}
+
+// hasToolHistory 判断历史消息中是否包含工具调用或工具结果
+func (r *OpenAIChatCompletionRequest) hasToolHistory() bool {
+	for _, msg := range r.Messages {
+		if msg.Role == "tool" || len(msg.ToolCalls) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildToolMessages 返回注入工具提示词并将 tool 角色消息转换为文本后的消息列表,不修改原请求
+func (r *OpenAIChatCompletionRequest) BuildToolMessages() ([]OpenAIChatMessage, error) {
+	if !r.NeedToolPrompt() && !r.hasToolHistory() {
+		return r.Messages, nil
+	}
+
+	// 记录 tool_call_id 对应的函数名,用于标注工具结果
+	toolNames := map[string]string{}
+	for _, msg := range r.Messages {
+		for _, call := range msg.ToolCalls {
+			toolNames[call.ID] = call.Function.Name
+		}
+	}
+
+	var messages []OpenAIChatMessage
+	if r.NeedToolPrompt() {
+		toolsJSON, err := json.Marshal(r.Tools)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal tools: %v", err)
+		}
+		messages = append(messages, OpenAIChatMessage{
+			Role:    "system",
+			Content: fmt.Sprintf(toolPromptTemplate, toolChoicePrompt(r.ToolChoice), string(toolsJSON)),
+		})
+	}
+
+	for _, msg := range r.Messages {
+		switch {
+		case msg.Role == "tool":
+			name := msg.Name
+			if name == "" {
+				name = toolNames[msg.ToolCallId]
+			}
+			messages = append(messages, OpenAIChatMessage{
+				Role: "user",
+				Content: fmt.Sprintf("<tool_result tool_call_id=%q name=%q>\n%s\n</tool_result>",
+					msg.ToolCallId, name, contentToString(msg.Content)),
+			})
+		case len(msg.ToolCalls) > 0:
+			var content strings.Builder
+			content.WriteString(contentToString(msg.Content))
+			for _, call := range msg.ToolCalls {
+				if content.Len() > 0 {
+					content.WriteString("\n")
+				}
+				content.WriteString(formatToolCall(call))
+			}
+			messages = append(messages, OpenAIChatMessage{
+				Role:    msg.Role,
+				Content: content.String(),
+			})
+		default:
+			messages = append(messages, msg)
+		}
+	}
+	return messages, nil
+}
+
+func toolChoicePrompt(toolChoice interface{}) string {
+	switch choice := toolChoice.(type) {
+	case string:
+		if choice == "required" {
+			return "You MUST call at least one tool in this reply.\n"
+		}
+	case map[string]interface{}:
+		if function, ok := choice["function"].(map[string]interface{}); ok {
+			if name, ok := function["name"].(string); ok && name != "" {
+				return fmt.Sprintf("You MUST call the tool %q in this reply.\n", name)
+			}
+		}
+	}
+	return ""
+}
+
+func formatToolCall(call OpenAIToolCall) string {
+	arguments := json.RawMessage(call.Function.Arguments)
+	if !json.Valid(arguments) {
+		arguments, _ = json.Marshal(call.Function.Arguments)
+	}
+	callJSON, _ := json.Marshal(struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}{
+		Name:      call.Function.Name,
+		Arguments: arguments,
+	})
+	return toolCallStartTag + string(callJSON) + toolCallEndTag
+}
+
+func contentToString(content interface{}) string {
+	switch v := content.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []interface{}:
+		// 多段文本内容直接拼接
+		var texts []string
+		for _, item := range v {
+			if itemMap, ok := item.(map[string]interface{}); ok {
+				if text, ok := itemMap["text"].(string); ok {
+					texts = append(texts, text)
+				}
+			}
+		}
+		if len(texts) == len(v) {
+			return strings.Join(texts, "\n")
+		}
+	}
+	contentBytes, _ := json.Marshal(content)
+	return string(contentBytes)
+}
+
+// ParseToolCalls 从模型输出中解析工具调用,返回去除工具调用块后的文本
+func ParseToolCalls(text string) (string, []OpenAIToolCall) {
+	var content strings.Builder
+	var calls []OpenAIToolCall
+
+	for {
+		start := strings.Index(text, toolCallStartTag)
+		if start == -1 {
+			content.WriteString(text)
+			break
+		}
+		end := strings.Index(text[start:], toolCallEndTag)
+		if end == -1 {
+			// 未闭合的块尝试按完整JSON解析
+			if call, ok := parseToolCall(text[start+len(toolCallStartTag):]); ok {
+				content.WriteString(text[:start])
+				calls = append(calls, call)
+			} else {
+				content.WriteString(text)
+			}
+			break
+		}
+		end += start
+
+		if call, ok := parseToolCall(text[start+len(toolCallStartTag) : end]); ok {
+			content.WriteString(text[:start])
+			calls = append(calls, call)
+		} else {
+			content.WriteString(text[:end+len(toolCallEndTag)])
+		}
+		text = text[end+len(toolCallEndTag):]
+	}
+
+	return strings.TrimSpace(content.String()), calls
+}
+
+func parseToolCall(raw string) (OpenAIToolCall, bool) {
+	raw = strings.TrimSpace(raw)
+	raw = strings.TrimPrefix(raw, "```json")
+	raw = strings.TrimPrefix(raw, "```")
+	raw = strings.TrimSuffix(raw, "```")
+	raw = strings.TrimSpace(raw)
+
+	var call struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	}
+	if err := json.Unmarshal([]byte(raw), &call); err != nil || call.Name == "" {
+		return OpenAIToolCall{}, false
+	}
+
+	arguments := "{}"
+	if len(call.Arguments) > 0 {
+		// arguments 可能被模型输出为字符串形式的JSON
+		var argumentsString string
+		if err := json.Unmarshal(call.Arguments, &argumentsString); err == nil {
+			arguments = argumentsString
+		} else {
+			arguments = string(call.Arguments)
+		}
+	}
+
+	return OpenAIToolCall{
+		ID:   "call_" + common.GetUUID()[:24],
+		Type: "function",
+		Function: OpenAIFunctionCall{
+			Name:      call.Name,
+			Arguments: arguments,
+		},
+	}, true
+}
+
+// ToolCallStreamParser 在流式输出中拦截工具调用块,只放行工具调用之前的普通文本
+type ToolCallStreamParser struct {
+	buffer  strings.Builder
+	emitted int
+	inTool  bool
+}
+
+// Feed 写入增量文本,返回可以立即发送给客户端的文本
+func (p *ToolCallStreamParser) Feed(delta string) string {
+	p.buffer.WriteString(delta)
+	if p.inTool {
+		return ""
+	}
+
+	text := p.buffer.String()
+	pending := text[p.emitted:]
+	if idx := strings.Index(pending, toolCallStartTag); idx != -1 {
+		p.inTool = true
+		p.emitted += idx
+		return pending[:idx]
+	}
+
+	// 保留可能是开始标签前缀的尾部,等待更多数据
+	safe := len(pending)
+	for i := 1; i < len(toolCallStartTag) && i <= len(pending); i++ {
+		if strings.HasSuffix(pending, toolCallStartTag[:i]) {
+			safe = len(pending) - i
+		}
+	}
+	p.emitted += safe
+	return pending[:safe]
+}
+
+// Finish 结束解析,返回尚未发送的文本以及解析出的工具调用
+func (p *ToolCallStreamParser) Finish() (string, []OpenAIToolCall) {
+	rest := p.buffer.String()[p.emitted:]
+	content, calls := ParseToolCalls(rest)
+	if len(calls) == 0 {
+		return rest, nil
+	}
+	return content, calls
+}
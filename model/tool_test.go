@@ -0,0 +1,117 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseToolCalls(t *testing.T) {
+	tests := []struct {
+		name        string
+		text        string
+		wantContent string
+		wantCalls   []OpenAIFunctionCall
+	}{
+		{
+			name:        "no tool call",
+			text:        "just an answer",
+			wantContent: "just an answer",
+		},
+		{
+			name:        "single call",
+			text:        `Let me check. <tool_call>{"name": "get_weather", "arguments": {"city": "Paris"}}</tool_call>`,
+			wantContent: "Let me check.",
+			wantCalls:   []OpenAIFunctionCall{{Name: "get_weather", Arguments: `{"city": "Paris"}`}},
+		},
+		{
+			name: "multiple calls",
+			text: `<tool_call>{"name": "a", "arguments": {}}</tool_call>
+<tool_call>{"name": "b", "arguments": {"x": 1}}</tool_call>`,
+			wantCalls: []OpenAIFunctionCall{{Name: "a", Arguments: `{}`}, {Name: "b", Arguments: `{"x": 1}`}},
+		},
+		{
+			name:      "string arguments and code fence",
+			text:      "<tool_call>```json\n{\"name\": \"a\", \"arguments\": \"{\\\"x\\\":1}\"}\n```</tool_call>",
+			wantCalls: []OpenAIFunctionCall{{Name: "a", Arguments: `{"x":1}`}},
+		},
+		{
+			name:      "missing arguments",
+			text:      `<tool_call>{"name": "a"}</tool_call>`,
+			wantCalls: []OpenAIFunctionCall{{Name: "a", Arguments: `{}`}},
+		},
+		{
+			name:      "unterminated block",
+			text:      `<tool_call>{"name": "a", "arguments": {}}`,
+			wantCalls: []OpenAIFunctionCall{{Name: "a", Arguments: `{}`}},
+		},
+		{
+			name:        "invalid json kept as text",
+			text:        `<tool_call>not json</tool_call> done`,
+			wantContent: `<tool_call>not json</tool_call> done`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, calls := ParseToolCalls(tt.text)
+			if content != tt.wantContent {
+				t.Errorf("content = %q, want %q", content, tt.wantContent)
+			}
+			if len(calls) != len(tt.wantCalls) {
+				t.Fatalf("calls = %+v, want %+v", calls, tt.wantCalls)
+			}
+			for i, call := range calls {
+				if call.Function != tt.wantCalls[i] || call.Type != "function" || !strings.HasPrefix(call.ID, "call_") {
+					t.Errorf("call %d = %+v, want %+v", i, call, tt.wantCalls[i])
+				}
+			}
+		})
+	}
+}
+
+func TestToolCallStreamParser(t *testing.T) {
+	tests := []struct {
+		name        string
+		chunks      []string
+		wantEmitted string
+		wantRest    string
+		wantCalls   int
+	}{
+		{
+			name:        "plain text passes through",
+			chunks:      []string{"hello ", "world"},
+			wantEmitted: "hello world",
+		},
+		{
+			name:        "start tag split across chunks",
+			chunks:      []string{"text <tool", "_call>{\"name\": \"a\", \"arguments\": {}}", "</tool_call>"},
+			wantEmitted: "text ",
+			wantCalls:   1,
+		},
+		{
+			name:        "tag prefix that is not a tool call",
+			chunks:      []string{"a <to", "p> b"},
+			wantEmitted: "a <top> b",
+		},
+		{
+			name:        "invalid tool call returned on finish",
+			chunks:      []string{"x <tool_call>oops</tool_call>"},
+			wantEmitted: "x ",
+			wantRest:    "<tool_call>oops</tool_call>",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &ToolCallStreamParser{}
+			var emitted string
+			for _, chunk := range tt.chunks {
+				emitted += p.Feed(chunk)
+			}
+			rest, calls := p.Finish()
+			if emitted != tt.wantEmitted || rest != tt.wantRest || len(calls) != tt.wantCalls {
+				t.Errorf("emitted = %q, rest = %q, calls = %d, want %q, %q, %d", emitted, rest, len(calls), tt.wantEmitted, tt.wantRest, tt.wantCalls)
+			}
+		})
+	}
+}
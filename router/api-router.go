@@ -11,6 +11,7 @@ import (
 	"getbind2api/middleware"
 	"strings"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 )
@@ -29,10 +30,37 @@ func SetApiRouter(router *gin.Engine) {
 
 	v1Router := router.Group(fmt.Sprintf("%s/v1", ProcessPath(config.RoutePrefix)))
 	v1Router.Use(middleware.OpenAIAuth())
-	v1Router.POST("/chat/completions", controller.ChatForOpenAI)
+	v1Router.POST("/chat/completions", middleware.Metrics(), middleware.RequestLog(), controller.ChatForOpenAI)
+	v1Router.POST("/messages", middleware.Metrics(), middleware.RequestLog(), controller.ChatForClaude)
 	//v1Router.POST("/images/generations", controller.ImagesForOpenAI)
 	v1Router.GET("/models", controller.OpenaiModels)
+	v1Router.GET("/models/:id", controller.OpenaiModel)
 
+	// 监控指标包含cookie池与账号信息,与管理接口一样未设置 BACKEND_SECRET 时不开放
+	if config.MetricsEnable == 1 && config.BackendSecret != "" {
+		router.GET(fmt.Sprintf("%s/metrics", ProcessPath(config.RoutePrefix)), middleware.BackendAuth(), gin.WrapH(promhttp.Handler()))
+	}
+
+	// 管理接口,未设置 BACKEND_SECRET 时不开放
+	if config.BackendApiEnable == 1 && config.BackendSecret != "" {
+		apiRouter := router.Group(fmt.Sprintf("%s/api", ProcessPath(config.RoutePrefix)))
+		apiRouter.Use(middleware.BackendAuth())
+		apiRouter.GET("/cookies", controller.ListCookies)
+		apiRouter.GET("/cookies/health", controller.CookiesHealth)
+		apiRouter.POST("/cookies/:userId/check", controller.CheckCookieHealth)
+		apiRouter.POST("/cookies", controller.AddCookies)
+		apiRouter.PUT("/cookies/:userId/disable", controller.DisableCookie)
+		apiRouter.PUT("/cookies/:userId/enable", controller.EnableCookie)
+		apiRouter.PUT("/cookies/:userId", controller.UpdateCookie)
+		apiRouter.DELETE("/cookies/:userId", controller.DeleteCookie)
+		apiRouter.GET("/keys", controller.ListApiKeys)
+		apiRouter.GET("/keys/usage", controller.ApiKeysUsage)
+		apiRouter.POST("/keys", controller.AddApiKey)
+		apiRouter.PUT("/keys/:id", controller.UpdateApiKey)
+		apiRouter.DELETE("/keys/:id", controller.DeleteApiKey)
+		apiRouter.GET("/logs", controller.ListRequestLogs)
+		apiRouter.GET("/proxies", controller.ListProxies)
+	}
 }
 
 func ProcessPath(path string) string {
@@ -0,0 +1,45 @@
+package router
+
+import (
+	"getbind2api/common/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMetricsRequiresBackendSecret(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	saved := config.BackendSecret
+	t.Cleanup(func() { config.BackendSecret = saved })
+
+	tests := []struct {
+		name          string
+		backendSecret string
+		authorization string
+		wantStatus    int
+	}{
+		{"no secret", "", "", http.StatusNotFound},
+		{"missing authorization", "secret", "", http.StatusUnauthorized},
+		{"wrong authorization", "secret", "Bearer wrong", http.StatusUnauthorized},
+		{"authorized", "secret", "Bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config.BackendSecret = tt.backendSecret
+			router := gin.New()
+			SetApiRouter(router)
+
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}